@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"context"
+	"de/internal/core"
+	"de/internal/storage/sqlstorage"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var benchUpdatesCmdArgs struct {
+	Strategies []string
+	Rows       []int
+	Clients    int
+	Duration   time.Duration
+	Isolation  string
+	MaxRetries int
+	Seed       int64
+}
+
+var benchQueriesCmdArgs struct {
+	Cases       []string
+	Category    string
+	Runs        int
+	Warmup      int
+	Concurrency int
+	Format      string
+	Refresh     bool
+}
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "run concurrent workloads against the database and measure them",
+}
+
+var benchUpdatesCmd = &cobra.Command{
+	Use:   "updates",
+	Short: "compare blind, optimistic and pessimistic increments of sales rows",
+	Long: `Has concurrent clients increment the quantity of random sales rows, reading
+each row and writing it back. Blind updates overwrite the row in a transaction,
+optimistic updates write it only if its version did not change and retry
+otherwise, pessimistic updates lock it with SELECT ... FOR UPDATE first.
+
+Each strategy runs at every contention level, the number of rows the clients
+share, on its own scratch table. The committed increments missing from the
+table at the end are reported as lost.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a := benchUpdatesCmdArgs
+		isolation, err := core.ParseIsolationLevel(a.Isolation)
+		if err != nil {
+			return err
+		}
+		cfg := core.UpdateBenchConfig{
+			Rows:       a.Rows,
+			Clients:    a.Clients,
+			Duration:   a.Duration,
+			Isolation:  isolation,
+			MaxRetries: a.MaxRetries,
+			Seed:       a.Seed,
+		}
+		for _, name := range a.Strategies {
+			s, err := core.ParseUpdateStrategy(name)
+			if err != nil {
+				return err
+			}
+			cfg.Strategies = append(cfg.Strategies, s)
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+
+		store, err := sqlstorage.Open(ctx, sqlstorage.Config{
+			Dialect: sqlstorage.Dialect(rootCmdArgs.Driver),
+			DSN:     rootCmdArgs.DSN,
+		})
+		if err != nil {
+			return err
+		}
+		defer store.Close(ctx)
+
+		results, err := core.BenchmarkUpdates(ctx, store, cfg)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf(
+			"%d client(s), %s per run at %s on %s\n\n",
+			cfg.Clients, cfg.Duration, a.Isolation, store.Dialect,
+		)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "rows\tstrategy\tupdates/s\tmean latency\tupdates\tretries\tfailures\tlost\t")
+		for _, r := range results {
+			fmt.Fprintf(
+				w, "%d\t%s\t%.1f\t%s\t%d\t%d\t%d\t%d\t\n",
+				r.Rows, r.Strategy, r.Throughput, r.MeanLatency.Round(time.Microsecond),
+				r.Updates, r.Retries, r.Failures, r.Lost,
+			)
+		}
+		return w.Flush()
+	},
+}
+
+var benchQueriesCmd = &cobra.Command{
+	Use:   "queries",
+	Short: "measure the latency distribution of the queries of the analysis catalog",
+	Long: `Runs each query of the analysis catalog a number of times after a few warmup
+runs, by one or more concurrent clients, and reports the percentiles of their
+latency, their throughput and the rows they return and examine. The rows
+examined are counted by EXPLAIN ANALYZE, SQLite has no such count.
+
+The employees are read as they are, --refresh reseeds them first. The report is
+a table, or JSON or CSV for processing elsewhere.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a := benchQueriesCmdArgs
+		switch a.Format {
+		case "table", "json", "csv":
+		default:
+			return fmt.Errorf("unknown output format %q", a.Format)
+		}
+		cfg := core.QueryBenchConfig{
+			Runs:        a.Runs,
+			Warmup:      a.Warmup,
+			Concurrency: a.Concurrency,
+		}
+		for _, name := range a.Cases {
+			c, ok := sqlstorage.QueryCaseNamed(name)
+			if !ok {
+				return fmt.Errorf("unknown query case %q", name)
+			}
+			cfg.Cases = append(cfg.Cases, c)
+		}
+		if len(a.Cases) == 0 {
+			for _, c := range sqlstorage.QueryCatalog {
+				if a.Category == "" || string(c.Category) == a.Category {
+					cfg.Cases = append(cfg.Cases, c)
+				}
+			}
+		}
+		if len(cfg.Cases) == 0 {
+			return fmt.Errorf("no query case in category %q", a.Category)
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+
+		store, err := sqlstorage.Open(ctx, sqlstorage.Config{
+			Dialect: sqlstorage.Dialect(rootCmdArgs.Driver),
+			DSN:     rootCmdArgs.DSN,
+		})
+		if err != nil {
+			return err
+		}
+		defer store.Close(ctx)
+
+		if a.Refresh {
+			if err := store.RefreshEmployees(ctx); err != nil {
+				return err
+			}
+		}
+
+		results, err := core.BenchmarkQueries(ctx, store, cfg)
+		if err != nil {
+			return err
+		}
+
+		switch a.Format {
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(results)
+		case "csv":
+			return writeQueryBenchCSV(results)
+		}
+
+		fmt.Printf(
+			"%d run(s) after %d warmup run(s) by %d client(s) on %s\n\n",
+			cfg.Runs, cfg.Warmup, cfg.Concurrency, store.Dialect,
+		)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "query\tp50\tp90\tp99\tmax\tqueries/s\trows\texamined\terrors\t")
+		for _, r := range results {
+			if r.Error != "" {
+				fmt.Fprintf(w, "%s\t%s\t\n", r.Label, r.Error)
+				continue
+			}
+			examined := "n/a"
+			if r.RowsExamined >= 0 {
+				examined = strconv.FormatFloat(r.RowsExamined, 'f', -1, 64)
+			}
+			fmt.Fprintf(
+				w, "%s\t%s\t%s\t%s\t%s\t%.1f\t%d\t%s\t%d\t\n",
+				r.Label, r.P50.Round(time.Microsecond), r.P90.Round(time.Microsecond),
+				r.P99.Round(time.Microsecond), r.Max.Round(time.Microsecond),
+				r.Throughput, r.Rows, examined, r.Errors,
+			)
+		}
+		return w.Flush()
+	},
+}
+
+// writeQueryBenchCSV writes the results a row per query, the latencies in
+// microseconds. The rows examined are left empty when unknown.
+func writeQueryBenchCSV(results []core.QueryBenchResult) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{
+		"case", "label", "category", "runs", "errors", "rows", "rows_examined",
+		"throughput", "min_us", "mean_us", "p50_us", "p90_us", "p99_us", "max_us", "error",
+	})
+	us := func(d time.Duration) string {
+		return strconv.FormatInt(d.Microseconds(), 10)
+	}
+	for _, r := range results {
+		var examined string
+		if r.RowsExamined >= 0 {
+			examined = strconv.FormatFloat(r.RowsExamined, 'f', -1, 64)
+		}
+		w.Write([]string{
+			r.Case, r.Label, string(r.Category), strconv.Itoa(r.Runs), strconv.Itoa(r.Errors),
+			strconv.Itoa(r.Rows), examined,
+			strconv.FormatFloat(r.Throughput, 'f', 1, 64),
+			us(r.Min), us(r.Mean), us(r.P50), us(r.P90), us(r.P99), us(r.Max), r.Error,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+	benchCmd.AddCommand(benchUpdatesCmd)
+	benchCmd.AddCommand(benchQueriesCmd)
+
+	strategies := make([]string, len(core.UpdateStrategies))
+	for i, s := range core.UpdateStrategies {
+		strategies[i] = string(s)
+	}
+	benchUpdatesCmd.Flags().StringSliceVar(&benchUpdatesCmdArgs.Strategies, "strategies", strategies, "update strategies to compare (blind|optimistic|pessimistic)")
+	benchUpdatesCmd.Flags().IntSliceVar(&benchUpdatesCmdArgs.Rows, "rows", []int{1, 4, 16, 64}, "contention levels, the number of rows the clients increment")
+	benchUpdatesCmd.Flags().IntVar(&benchUpdatesCmdArgs.Clients, "clients", 8, "number of concurrent clients")
+	benchUpdatesCmd.Flags().DurationVar(&benchUpdatesCmdArgs.Duration, "duration", 5*time.Second, "how long each strategy runs at each level")
+	benchUpdatesCmd.Flags().StringVar(&benchUpdatesCmdArgs.Isolation, "isolation", "read-committed", "isolation level of the blind and pessimistic transactions")
+	benchUpdatesCmd.Flags().IntVar(&benchUpdatesCmdArgs.MaxRetries, "max-retries", 100, "attempts of an optimistic increment before it gives up")
+	benchUpdatesCmd.Flags().Int64Var(&benchUpdatesCmdArgs.Seed, "seed", time.Now().UnixNano(), "seed of the random rows picked")
+
+	benchQueriesCmd.Flags().StringSliceVar(&benchQueriesCmdArgs.Cases, "cases", nil, "names of the query cases to run, all of them by default")
+	benchQueriesCmd.Flags().StringVar(&benchQueriesCmdArgs.Category, "category", "", "run only the cases of a category (Lookups|Index pitfalls|Pagination)")
+	benchQueriesCmd.Flags().IntVar(&benchQueriesCmdArgs.Runs, "runs", 50, "timed runs of each query")
+	benchQueriesCmd.Flags().IntVar(&benchQueriesCmdArgs.Warmup, "warmup", 5, "untimed runs of each query before the timed ones")
+	benchQueriesCmd.Flags().IntVar(&benchQueriesCmdArgs.Concurrency, "concurrency", 1, "number of clients running the query at once")
+	benchQueriesCmd.Flags().StringVar(&benchQueriesCmdArgs.Format, "format", "table", "output format (table|json|csv)")
+	benchQueriesCmd.Flags().BoolVar(&benchQueriesCmdArgs.Refresh, "refresh", false, "reseed the employees before the run")
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"de/internal/app/checkapp"
+	"de/internal/core"
+	"de/internal/storage/sqlstorage"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var checkBankCmdArgs struct {
+	Isolation   string
+	Duration    time.Duration
+	Clients     int
+	ReadRatio   float64
+	MaxAmount   uint64
+	Seed        int64
+	ReportPath  string
+	HistoryPath string
+}
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "run workloads against the database and check their histories",
+}
+
+var checkBankCmd = &cobra.Command{
+	Use:   "bank",
+	Short: "run concurrent transfers and reads of the accounts and check the balances",
+	Long: `Runs a randomized workload of concurrent transfers between the accounts and
+reads of every balance, recording when each operation was invoked and completed.
+The history is then checked for reads whose balances do not add up to the
+initial total, negative balances and reads no serial order of the transfers
+explains. The report and the gzipped history are written out, the command
+fails when the history is invalid.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a := checkBankCmdArgs
+		isolation, err := core.ParseIsolationLevel(a.Isolation)
+		if err != nil {
+			return err
+		}
+		if a.Clients < 1 || a.MaxAmount < 1 {
+			return fmt.Errorf("--clients and --max-amount must be at least 1")
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+
+		cfg := checkapp.BankConfig{
+			Store: sqlstorage.Config{
+				Dialect: sqlstorage.Dialect(rootCmdArgs.Driver),
+				DSN:     rootCmdArgs.DSN,
+			},
+			Isolation:   isolation,
+			Duration:    a.Duration,
+			Clients:     a.Clients,
+			ReadRatio:   a.ReadRatio,
+			MaxAmount:   a.MaxAmount,
+			Seed:        a.Seed,
+			ReportPath:  a.ReportPath,
+			HistoryPath: a.HistoryPath,
+		}
+		report, err := checkapp.RunBank(ctx, cfg)
+		if err != nil && err != checkapp.ErrInvalid {
+			return err
+		}
+		checkapp.FormatBankReport(os.Stdout, cfg, report)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+	checkCmd.AddCommand(checkBankCmd)
+
+	checkBankCmd.Flags().StringVar(&checkBankCmdArgs.Isolation, "isolation", "read-committed", "isolation level of the transfers and reads")
+	checkBankCmd.Flags().DurationVar(&checkBankCmdArgs.Duration, "duration", 30*time.Second, "how long the workload runs")
+	checkBankCmd.Flags().IntVar(&checkBankCmdArgs.Clients, "clients", 5, "number of concurrent clients")
+	checkBankCmd.Flags().Float64Var(&checkBankCmdArgs.ReadRatio, "read-ratio", 0.5, "share of operations that read every balance")
+	checkBankCmd.Flags().Uint64Var(&checkBankCmdArgs.MaxAmount, "max-amount", 50, "largest amount transferred")
+	checkBankCmd.Flags().Int64Var(&checkBankCmdArgs.Seed, "seed", time.Now().UnixNano(), "seed of the random workload")
+	checkBankCmd.Flags().StringVar(&checkBankCmdArgs.ReportPath, "report", "bank-report.txt", "file the report is written to")
+	checkBankCmd.Flags().StringVar(&checkBankCmdArgs.HistoryPath, "history-out", "bank-history.jsonl.gz", "file the gzipped history is written to")
+}
@@ -6,14 +6,25 @@ package cmd
 import (
 	"context"
 	"de/internal/app/httpapp"
+	"de/internal/storage/sqlstorage"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var rootCmdArgs struct {
-	Port uint16
+	Port          uint16
+	Driver        string
+	DSN           string
+	HistoryPath   string
+	Sandboxes     bool
+	SandboxDir    string
+	SandboxIdle   time.Duration
+	MaxSandboxes  int
+	MaxSims       int
+	MaxClientSims int
 }
 
 // rootCmd represents the base command when called without any subcommands
@@ -26,7 +37,20 @@ var rootCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 		defer cancel()
-		return httpapp.Run(ctx, rootCmdArgs.Port)
+		return httpapp.Run(ctx, httpapp.Config{
+			Port: rootCmdArgs.Port,
+			Store: sqlstorage.Config{
+				Dialect: sqlstorage.Dialect(rootCmdArgs.Driver),
+				DSN:     rootCmdArgs.DSN,
+			},
+			HistoryPath:          rootCmdArgs.HistoryPath,
+			Sandboxes:            rootCmdArgs.Sandboxes,
+			SandboxDir:           rootCmdArgs.SandboxDir,
+			SandboxIdleTime:      rootCmdArgs.SandboxIdle,
+			MaxSandboxes:         rootCmdArgs.MaxSandboxes,
+			MaxSimulations:       rootCmdArgs.MaxSims,
+			MaxClientSimulations: rootCmdArgs.MaxClientSims,
+		})
 	},
 }
 
@@ -49,4 +73,13 @@ func init() {
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.PersistentFlags().Uint16VarP(&rootCmdArgs.Port, "port", "p", 4444, "port the application will listen for requests on")
+	rootCmd.PersistentFlags().StringVar(&rootCmdArgs.Driver, "driver", "mysql", "database backend holding the demo data (mysql|sqlite)")
+	rootCmd.PersistentFlags().StringVar(&rootCmdArgs.DSN, "dsn", "", "data source name of the demo database (default depends on --driver)")
+	rootCmd.PersistentFlags().StringVar(&rootCmdArgs.HistoryPath, "history", "de-history.db", "SQLite database simulation runs are saved to")
+	rootCmd.PersistentFlags().BoolVar(&rootCmdArgs.Sandboxes, "sandboxes", false, "give every browser session its own copy of the demo database")
+	rootCmd.PersistentFlags().StringVar(&rootCmdArgs.SandboxDir, "sandbox-dir", "sandboxes", "directory holding the database files of SQLite sandboxes")
+	rootCmd.PersistentFlags().DurationVar(&rootCmdArgs.SandboxIdle, "sandbox-idle", 30*time.Minute, "how long an unused sandbox is kept before being dropped")
+	rootCmd.PersistentFlags().IntVar(&rootCmdArgs.MaxSandboxes, "max-sandboxes", 16, "sandboxes allowed to exist at once, 0 for no limit")
+	rootCmd.PersistentFlags().IntVar(&rootCmdArgs.MaxSims, "max-simulations", 32, "isolation simulations allowed to run at once, 0 for no limit")
+	rootCmd.PersistentFlags().IntVar(&rootCmdArgs.MaxClientSims, "max-client-simulations", 3, "isolation simulations a single client may run at once, 0 for no limit")
 }
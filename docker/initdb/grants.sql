@@ -0,0 +1,6 @@
+-- Let the demo user inspect the locks held by the simulations.
+GRANT PROCESS ON *.* TO 'detest'@'%';
+GRANT SELECT ON performance_schema.* TO 'detest'@'%';
+
+-- Let it create and drop the per-session sandbox schemas (--sandboxes).
+GRANT ALL PRIVILEGES ON `desb\_%`.* TO 'detest'@'%';
@@ -0,0 +1,279 @@
+package checkapp
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"de/internal/core"
+	"de/internal/storage/sqlstorage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+type BankConfig struct {
+	Store     sqlstorage.Config
+	Isolation sql.IsolationLevel
+	Duration  time.Duration
+	// Clients is the number of concurrent clients, each running one
+	// operation at a time.
+	Clients int
+	// ReadRatio is the share of operations that read every balance, the
+	// rest are transfers.
+	ReadRatio float64
+	MaxAmount uint64
+	Seed      int64
+	// ReportPath and HistoryPath are where the report and the gzipped JSON
+	// lines of the history are written.
+	ReportPath  string
+	HistoryPath string
+}
+
+// ErrInvalid is returned when the checked history breaks an invariant.
+var ErrInvalid = errors.New("bank history is invalid")
+
+// RunBank runs the randomized bank workload against the accounts table,
+// which it reseeds leaving the other tables alone, then checks the recorded
+// history and writes the report and history.
+func RunBank(ctx context.Context, cfg BankConfig) (core.BankReport, error) {
+	store, err := sqlstorage.Open(ctx, cfg.Store)
+	if err != nil {
+		return core.BankReport{}, err
+	}
+	defer store.Close(ctx)
+
+	if err := store.RefreshAccounts(ctx); err != nil {
+		return core.BankReport{}, err
+	}
+
+	initial, err := store.ReadBalances(ctx, sql.LevelSerializable)
+	if err != nil {
+		return core.BankReport{}, fmt.Errorf("read initial balances: %v", err)
+	}
+	accounts := make([]uint64, 0, len(initial))
+	for id := range initial {
+		accounts = append(accounts, id)
+	}
+	if len(accounts) < 2 {
+		return core.BankReport{}, errors.New("the bank workload needs at least two accounts")
+	}
+
+	h := &bankHistory{start: time.Now()}
+	log.Printf(
+		"running bank workload with %d client(s) for %s at %s...",
+		cfg.Clients, cfg.Duration, cfg.Isolation,
+	)
+
+	runCtx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for p := 1; p <= cfg.Clients; p++ {
+		c := bankClient{
+			process:  p,
+			store:    store,
+			cfg:      cfg,
+			accounts: accounts,
+			history:  h,
+			rnd:      rand.New(rand.NewSource(cfg.Seed + int64(p))),
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.run(runCtx)
+		}()
+	}
+	wg.Wait()
+
+	// A final read once every client stopped, by the otherwise unused
+	// process 0.
+	final := bankClient{process: 0, store: store, cfg: cfg, history: h}
+	final.read(ctx)
+
+	report := core.CheckBank(initial, h.events)
+
+	if err := writeBankReport(cfg, report); err != nil {
+		return report, err
+	}
+	if err := writeBankHistory(cfg.HistoryPath, h.events); err != nil {
+		return report, err
+	}
+
+	if !report.Valid {
+		return report, ErrInvalid
+	}
+	return report, nil
+}
+
+// bankHistory records the events of every client in the order they happen.
+type bankHistory struct {
+	mu     sync.Mutex
+	start  time.Time
+	events []core.BankEvent
+}
+
+func (h *bankHistory) record(e core.BankEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e.Time = time.Since(h.start)
+	h.events = append(h.events, e)
+}
+
+type bankClient struct {
+	process  int
+	store    *sqlstorage.Store
+	cfg      BankConfig
+	accounts []uint64
+	history  *bankHistory
+	rnd      *rand.Rand
+}
+
+func (c *bankClient) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if c.rnd.Float64() < c.cfg.ReadRatio {
+			c.read(ctx)
+		} else {
+			c.transfer(ctx)
+		}
+	}
+}
+
+func (c *bankClient) read(ctx context.Context) {
+	c.history.record(core.BankEvent{
+		Process: c.process,
+		Type:    core.BankInvoke,
+		F:       core.BankReadF,
+	})
+
+	balances, err := c.store.ReadBalances(ctx, c.cfg.Isolation)
+	e := core.BankEvent{
+		Process:  c.process,
+		Type:     core.BankOK,
+		F:        core.BankReadF,
+		Balances: balances,
+	}
+	if err != nil {
+		e.Type = core.BankFail
+		e.Balances = nil
+		e.Error = err.Error()
+	}
+	c.history.record(e)
+}
+
+func (c *bankClient) transfer(ctx context.Context) {
+	from := c.accounts[c.rnd.Intn(len(c.accounts))]
+	to := from
+	for to == from {
+		to = c.accounts[c.rnd.Intn(len(c.accounts))]
+	}
+	t := &core.BankTransfer{
+		From:   from,
+		To:     to,
+		Amount: uint64(c.rnd.Int63n(int64(c.cfg.MaxAmount))) + 1,
+	}
+
+	c.history.record(core.BankEvent{
+		Process:  c.process,
+		Type:     core.BankInvoke,
+		F:        core.BankTransferF,
+		Transfer: t,
+	})
+
+	err := c.store.TransferAt(ctx, c.cfg.Isolation, t.From, t.To, t.Amount)
+	e := core.BankEvent{
+		Process:  c.process,
+		Type:     core.BankOK,
+		F:        core.BankTransferF,
+		Transfer: t,
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, sqlstorage.ErrCommit), ctx.Err() != nil:
+		// The transaction may have committed before the error.
+		e.Type = core.BankInfo
+		e.Error = err.Error()
+	default:
+		e.Type = core.BankFail
+		e.Error = err.Error()
+	}
+	c.history.record(e)
+}
+
+func writeBankReport(cfg BankConfig, r core.BankReport) error {
+	f, err := os.Create(cfg.ReportPath)
+	if err != nil {
+		return fmt.Errorf("create report: %v", err)
+	}
+	defer f.Close()
+
+	FormatBankReport(f, cfg, r)
+	return f.Close()
+}
+
+// maxReportedViolations bounds the violations of each kind listed in the
+// report, all of them are in the history.
+const maxReportedViolations = 20
+
+func FormatBankReport(w io.Writer, cfg BankConfig, r core.BankReport) {
+	fmt.Fprintf(w, "Bank workload on %s at %s\n", cfg.Store.Dialect, cfg.Isolation)
+	fmt.Fprintf(
+		w, "%d client(s) for %s, %.0f%% reads, transfers of at most %d, seed %d\n\n",
+		cfg.Clients, cfg.Duration, cfg.ReadRatio*100, cfg.MaxAmount, cfg.Seed,
+	)
+	fmt.Fprintf(w, "reads:             %d\n", r.Reads)
+	fmt.Fprintf(w, "transfers:         %d ok, %d failed, %d unknown\n",
+		r.Transfers, r.FailedTransfers, r.UnknownTransfers)
+	fmt.Fprintf(w, "total balance:     %d\n", r.Total)
+	fmt.Fprintf(w, "unchecked reads:   %d\n\n", r.Unchecked)
+
+	for _, section := range []struct {
+		name       string
+		violations []core.BankViolation
+	}{
+		{"total balance violations", r.TotalViolations},
+		{"negative balances", r.NegativeBalances},
+		{"non-serializable reads", r.NonSerializable},
+	} {
+		fmt.Fprintf(w, "%s: %d\n", section.name, len(section.violations))
+		for i, v := range section.violations {
+			if i == maxReportedViolations {
+				fmt.Fprintf(w, "  ... %d more\n", len(section.violations)-i)
+				break
+			}
+			fmt.Fprintf(w, "  event %d, process %d at %s: %s\n",
+				v.Event, v.Process, v.Time.Round(time.Millisecond), v.Detail)
+		}
+	}
+
+	if r.Valid {
+		fmt.Fprintln(w, "\nvalid")
+	} else {
+		fmt.Fprintln(w, "\nINVALID")
+	}
+}
+
+func writeBankHistory(path string, events []core.BankEvent) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create history: %v", err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	enc := json.NewEncoder(gz)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("write history: %v", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("write history: %v", err)
+	}
+	return f.Close()
+}
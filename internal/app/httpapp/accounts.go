@@ -11,6 +11,7 @@ import (
 
 func handleTransfer(db *sqlstorage.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		db := requestStore(r, db)
 		req, err := parseTransferReq(r)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
@@ -2,26 +2,80 @@ package httpapp
 
 import (
 	"context"
+	"de/internal/storage/runstorage"
 	"de/internal/storage/sqlstorage"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 )
 
-func Run(ctx context.Context, port uint16) error {
-	store, err := sqlstorage.NewStore(ctx)
+type Config struct {
+	Port  uint16
+	Store sqlstorage.Config
+	// HistoryPath is the SQLite database simulation runs are saved to.
+	HistoryPath string
+	// Sandboxes gives every browser session its own copy of the demo
+	// database instead of sharing the one of Store.
+	Sandboxes       bool
+	SandboxDir      string
+	SandboxIdleTime time.Duration
+	// MaxSandboxes bounds the sandboxes live at once, the sessions asking
+	// for another are turned away. Zero means no limit.
+	MaxSandboxes int
+	// MaxSimulations bounds the isolation simulations running at once, in
+	// total and for a single client. Zero means no limit.
+	MaxSimulations       int
+	MaxClientSimulations int
+}
+
+func Run(ctx context.Context, cfg Config) error {
+	cursors, err := newCursorSigner()
+	if err != nil {
+		return err
+	}
+
+	store, err := sqlstorage.NewStore(ctx, cfg.Store)
 	if err != nil {
 		return err
 	}
 
-	router := routes(store)
+	runs, err := runstorage.NewStore(ctx, cfg.HistoryPath)
+	if err != nil {
+		return errors.Join(err, store.Close(ctx))
+	}
+
+	var sandboxes *sqlstorage.Sandboxes
+	var sess *sessions
+	if cfg.Sandboxes {
+		sandboxes, err = sqlstorage.NewSandboxes(ctx, store, sqlstorage.SandboxConfig{
+			Dir:  cfg.SandboxDir,
+			Idle: cfg.SandboxIdleTime,
+			Max:  cfg.MaxSandboxes,
+		})
+		if err != nil {
+			return errors.Join(err, runs.Close(ctx), store.Close(ctx))
+		}
+		sess, err = newSessions(sandboxes)
+		if err != nil {
+			return errors.Join(err, sandboxes.Close(ctx), runs.Close(ctx), store.Close(ctx))
+		}
+		go sandboxes.Run(ctx)
+	}
+
+	sims := newSimRegistry(cfg.MaxSimulations, cfg.MaxClientSimulations)
+	router := routes(store, runs, sess, sims, cursors)
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
+		Addr:    fmt.Sprintf(":%d", cfg.Port),
 		Handler: router,
 	}
 
+	// stopped is closed once the databases are closed, the sandboxes must be
+	// dropped before the process exits.
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		<-ctx.Done()
 		shutdownCtx, shutdownCancel := context.WithTimeout(
 			context.Background(), time.Second*4,
@@ -32,13 +86,31 @@ func Run(ctx context.Context, port uint16) error {
 			log.Printf("failed to gracefully shutdown http app")
 		}
 
+		// Shutdown does not wait for websockets, the simulations they run
+		// are cancelled instead.
+		sims.cancelAll()
+
+		if sandboxes != nil {
+			if err := sandboxes.Close(shutdownCtx); err != nil {
+				log.Printf("failed to drop sandboxes: %v", err)
+			}
+		}
+
 		if err := store.Close(ctx); err != nil {
 			log.Printf("failed to gracefully shutdown db")
 		}
+
+		if err := runs.Close(ctx); err != nil {
+			log.Printf("failed to gracefully shutdown run history db")
+		}
 	}()
 
-	log.Printf("starting app bound to port %d...", port)
+	log.Printf("starting app bound to port %d...", cfg.Port)
 	if err := srv.ListenAndServe(); err != nil {
+		if errors.Is(err, http.ErrServerClosed) {
+			<-stopped
+			return nil
+		}
 		return err
 	}
 
@@ -0,0 +1,319 @@
+package httpapp
+
+import (
+	"context"
+	"de/internal/core"
+	"de/internal/storage/sqlstorage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	consoleMaxOpen = 4
+	// consoleIdleTimeout closes the consoles left alone, each holds a
+	// connection of the pool and possibly locks.
+	consoleIdleTimeout = 2 * time.Minute
+	// consoleWaitNotice is how long a statement runs before the client is
+	// told it is waiting, usually on a lock held by another console.
+	consoleWaitNotice = 250 * time.Millisecond
+)
+
+const (
+	// Sent by the client.
+	wsOpen  wsMsgType = "open"
+	wsExec  wsMsgType = "exec"
+	wsClose wsMsgType = "close"
+
+	// Sent by the server.
+	wsOpened  wsMsgType = "opened"
+	wsWaiting wsMsgType = "waiting"
+	wsResult  wsMsgType = "result"
+	wsClosed  wsMsgType = "closed"
+)
+
+type consolePayload struct {
+	Console   int    `json:"console"`
+	Isolation string `json:"isolation,omitempty"`
+	SQL       string `json:"sql,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type consoleResultPayload struct {
+	Console  int              `json:"console"`
+	SQL      string           `json:"sql"`
+	Table    sqlstorage.Table `json:"table"`
+	Error    string           `json:"error,omitempty"`
+	Duration float64          `json:"ms"`
+}
+
+func handleConsole(store *sqlstorage.Store, sims *simRegistry) http.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := requestStore(r, store)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		defer conn.Close()
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		keepAlive(conn, ctx.Done())
+		msgs := readMessages(conn, ctx.Done(), cancel)
+
+		sess := &consoleSession{
+			store:    store,
+			sims:     sims,
+			client:   clientID(r),
+			conn:     conn,
+			consoles: map[int]*openConsole{},
+			events:   make(chan consoleEvent),
+		}
+		defer sess.closeAll()
+
+		if err := sess.serve(ctx, msgs); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+type openConsole struct {
+	console  *sqlstorage.Console
+	release  func()
+	busy     bool
+	lastUsed time.Time
+}
+
+// consoleEvent is sent by the goroutine running a statement back to the
+// session, which owns the connection.
+type consoleEvent struct {
+	Type    wsMsgType
+	Payload any
+}
+
+// consoleSession holds the consoles opened on a single connection, each with
+// its own database connection and open transaction, counted as a simulation
+// of the client. Statements run in the background so that a console blocked
+// on a lock does not hold up the others.
+//
+// Errors returned by its methods mean the connection is unusable, anything
+// the client should be told about is sent as an error message instead.
+type consoleSession struct {
+	store    *sqlstorage.Store
+	sims     *simRegistry
+	client   string
+	conn     *websocket.Conn
+	consoles map[int]*openConsole
+	lastID   int
+	events   chan consoleEvent
+}
+
+func (s *consoleSession) serve(ctx context.Context, msgs <-chan wsInbound) error {
+	idle := time.NewTicker(consoleIdleTimeout / 10)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-idle.C:
+			if err := s.closeIdle(now); err != nil {
+				return err
+			}
+		case ev := <-s.events:
+			if res, ok := ev.Payload.(consoleResultPayload); ok {
+				c, ok := s.consoles[res.Console]
+				if !ok {
+					continue
+				}
+				c.busy = false
+				c.lastUsed = time.Now()
+			}
+			if err := writeMessage(s.conn, ev.Type, ev.Payload); err != nil {
+				return err
+			}
+		case in, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			if in.Err != nil {
+				if err := writeError(s.conn, in.Err); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := s.handle(ctx, in.Msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *consoleSession) handle(ctx context.Context, msg wsMessage) error {
+	if msg.Type == wsPing {
+		return writeMessage(s.conn, wsPong, nil)
+	}
+
+	var payload consolePayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return writeError(s.conn, fmt.Errorf("decode %s: %v", msg.Type, err))
+	}
+
+	switch msg.Type {
+	case wsOpen:
+		return s.open(ctx, payload.Isolation)
+	case wsExec:
+		return s.exec(ctx, payload.Console, payload.SQL)
+	case wsClose:
+		return s.close(payload.Console, "closed by client")
+	}
+
+	return writeError(s.conn, fmt.Errorf("unknown message type %q", msg.Type))
+}
+
+func (s *consoleSession) open(ctx context.Context, isolation string) error {
+	if len(s.consoles) >= consoleMaxOpen {
+		return writeError(s.conn, fmt.Errorf(
+			"at most %d consoles can be open at once", consoleMaxOpen,
+		))
+	}
+
+	level, err := core.ParseIsolationLevel(isolation)
+	if err != nil {
+		return writeError(s.conn, err)
+	}
+
+	consoleCtx, release, err := s.sims.register(ctx, s.client, "console")
+	if err != nil {
+		return writeError(s.conn, err)
+	}
+	console, err := s.store.OpenConsole(consoleCtx, level)
+	if err != nil {
+		release()
+		return writeError(s.conn, err)
+	}
+
+	s.lastID += 1
+	s.consoles[s.lastID] = &openConsole{
+		console:  console,
+		release:  release,
+		lastUsed: time.Now(),
+	}
+
+	return writeMessage(s.conn, wsOpened, consolePayload{
+		Console:   s.lastID,
+		Isolation: isolation,
+	})
+}
+
+func (s *consoleSession) exec(ctx context.Context, id int, stmt string) error {
+	c, ok := s.consoles[id]
+	if !ok {
+		return writeError(s.conn, fmt.Errorf("console %d is not open", id))
+	}
+	if c.busy {
+		return writeError(s.conn, fmt.Errorf("console %d is still running a statement", id))
+	}
+	c.busy = true
+	c.lastUsed = time.Now()
+
+	send := func(ev consoleEvent) bool {
+		select {
+		case s.events <- ev:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	go func() {
+		done := make(chan consoleResultPayload, 1)
+		go func() {
+			start := time.Now()
+			table, err := c.console.Exec(ctx, stmt)
+			res := consoleResultPayload{
+				Console:  id,
+				SQL:      stmt,
+				Table:    table,
+				Duration: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				res.Error = err.Error()
+			}
+			done <- res
+		}()
+
+		select {
+		case res := <-done:
+			send(consoleEvent{Type: wsResult, Payload: res})
+			return
+		case <-time.After(consoleWaitNotice):
+			ok := send(consoleEvent{
+				Type:    wsWaiting,
+				Payload: consolePayload{Console: id, SQL: stmt},
+			})
+			if !ok {
+				return
+			}
+		}
+		send(consoleEvent{Type: wsResult, Payload: <-done})
+	}()
+
+	return nil
+}
+
+func (s *consoleSession) close(id int, reason string) error {
+	c, ok := s.consoles[id]
+	if !ok {
+		return writeError(s.conn, fmt.Errorf("console %d is not open", id))
+	}
+
+	delete(s.consoles, id)
+	if err := c.console.Close(); err != nil {
+		log.Println(err)
+	}
+	c.release()
+
+	return writeMessage(s.conn, wsClosed, consolePayload{
+		Console: id,
+		Reason:  reason,
+	})
+}
+
+func (s *consoleSession) closeIdle(now time.Time) error {
+	for id, c := range s.consoles {
+		if c.busy || now.Sub(c.lastUsed) < consoleIdleTimeout {
+			continue
+		}
+		reason := fmt.Sprintf("idle for more than %s", consoleIdleTimeout)
+		if err := s.close(id, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *consoleSession) closeAll() {
+	var errs []error
+	for id, c := range s.consoles {
+		delete(s.consoles, id)
+		errs = append(errs, c.console.Close())
+		c.release()
+	}
+	if err := errors.Join(errs...); err != nil {
+		log.Println(err)
+	}
+}
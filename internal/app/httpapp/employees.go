@@ -0,0 +1,264 @@
+package httpapp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"de/internal/storage/sqlstorage"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Bounds of a page of employees.
+const (
+	employeesDefaultLimit = 20
+	employeesMaxLimit     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// employeeCursor is where a keyset page starts, handed to clients as an
+// opaque token they cannot forge.
+type employeeCursor struct {
+	Sort sqlstorage.EmployeeSort `json:"s"`
+	// Key is the employee the page starts after, or ends before when
+	// backward. Without one the page is the first, or the last.
+	Key      *sqlstorage.EmployeeKey `json:"k,omitempty"`
+	Backward bool                    `json:"b,omitempty"`
+}
+
+// cursorSigner signs cursors with a key drawn when the server starts, the
+// cursors handed out before a restart are then rejected.
+type cursorSigner struct {
+	key []byte
+}
+
+func newCursorSigner() (*cursorSigner, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &cursorSigner{key: key}, nil
+}
+
+func (cs *cursorSigner) encode(c employeeCursor) string {
+	payload, _ := json.Marshal(c)
+	mac := hmac.New(sha256.New, cs.key)
+	mac.Write(payload)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func (cs *cursorSigner) decode(token string) (employeeCursor, error) {
+	enc := base64.RawURLEncoding
+	p, s, ok := strings.Cut(token, ".")
+	if !ok {
+		return employeeCursor{}, errInvalidCursor
+	}
+	payload, err := enc.DecodeString(p)
+	if err != nil {
+		return employeeCursor{}, errInvalidCursor
+	}
+	sum, err := enc.DecodeString(s)
+	if err != nil {
+		return employeeCursor{}, errInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, cs.key)
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return employeeCursor{}, errInvalidCursor
+	}
+
+	var c employeeCursor
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return employeeCursor{}, errInvalidCursor
+	}
+	return c, nil
+}
+
+// employeesPage is a page of employees and the way to the pages around it:
+// offsets in offset mode and cursors in keyset mode.
+type employeesPage struct {
+	sqlstorage.EmployeePage
+	Mode  string                  `json:"mode"`
+	Sort  sqlstorage.EmployeeSort `json:"sort"`
+	Limit int                     `json:"limit"`
+
+	Offset     int  `json:"offset"`
+	NextOffset *int `json:"nextOffset,omitempty"`
+	PrevOffset *int `json:"prevOffset,omitempty"`
+
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// listEmployees reads the page of the query parameters:
+//
+//	mode    offset or keyset, the default
+//	sort    id, the default, or name
+//	limit   employees per page
+//	offset  employees skipped in offset mode
+//	cursor  token of the page in keyset mode, the first page without one
+func listEmployees(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	cursors *cursorSigner,
+	params url.Values,
+) (employeesPage, error) {
+	page := employeesPage{
+		Mode:  params.Get("mode"),
+		Limit: employeesDefaultLimit,
+	}
+	if page.Mode == "" {
+		page.Mode = "keyset"
+	}
+	if l := params.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			return employeesPage{}, errors.New("invalid limit")
+		}
+		page.Limit = min(n, employeesMaxLimit)
+	}
+
+	sort := params.Get("sort")
+	if sort == "" {
+		sort = string(sqlstorage.EmployeesByID)
+	}
+	var err error
+	if page.Sort, err = sqlstorage.ParseEmployeeSort(sort); err != nil {
+		return employeesPage{}, err
+	}
+
+	switch page.Mode {
+	case "offset":
+		if o := params.Get("offset"); o != "" {
+			if page.Offset, err = strconv.Atoi(o); err != nil || page.Offset < 0 {
+				return employeesPage{}, errors.New("invalid offset")
+			}
+		}
+		page.EmployeePage, err = store.EmployeesByOffset(ctx, page.Sort, page.Offset, page.Limit)
+		if err != nil {
+			return employeesPage{}, err
+		}
+		if page.More {
+			next := page.Offset + page.Limit
+			page.NextOffset = &next
+		}
+		if page.Offset > 0 {
+			prev := max(page.Offset-page.Limit, 0)
+			page.PrevOffset = &prev
+		}
+	case "keyset":
+		c := employeeCursor{Sort: page.Sort}
+		if token := params.Get("cursor"); token != "" {
+			if c, err = cursors.decode(token); err != nil {
+				return employeesPage{}, err
+			}
+			if c.Sort != page.Sort {
+				return employeesPage{}, errors.New("the cursor is of another sort")
+			}
+		}
+		page.EmployeePage, err = store.EmployeesByKey(ctx, page.Sort, c.Key, c.Backward, page.Limit)
+		if err != nil {
+			return employeesPage{}, err
+		}
+
+		// Read forward there are employees before the page when it
+		// started after one, read backward there are employees after it
+		// when it ended before one.
+		hasNext, hasPrev := page.More, c.Key != nil
+		if c.Backward {
+			hasNext, hasPrev = c.Key != nil, page.More
+		}
+		if n := len(page.Employees); n > 0 {
+			if hasNext {
+				key := page.Employees[n-1].Key()
+				page.Next = cursors.encode(employeeCursor{Sort: page.Sort, Key: &key})
+			}
+			if hasPrev {
+				key := page.Employees[0].Key()
+				page.Prev = cursors.encode(employeeCursor{Sort: page.Sort, Key: &key, Backward: true})
+			}
+		}
+	default:
+		return employeesPage{}, errors.New("unknown pagination mode")
+	}
+
+	return page, nil
+}
+
+func handleEmployees(store *sqlstorage.Store, cursors *cursorSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := requestStore(r, store)
+		page, err := listEmployees(r.Context(), store, cursors, r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func handleEmployeesPage(store *sqlstorage.Store, cursors *cursorSigner) http.HandlerFunc {
+	type tdata struct {
+		Error string
+		Page  employeesPage
+		// LastOffset and LastCursor lead to the last page, the deepest one.
+		LastOffset int
+		LastCursor string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := requestStore(r, store)
+		t, err := template.ParseFiles(
+			"templates/base.tmpl.html",
+			"templates/employees.tmpl.html",
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var data tdata
+		data.Page, err = listEmployees(r.Context(), store, cursors, r.URL.Query())
+		if err != nil {
+			data.Error = err.Error()
+			data.Page = employeesPage{
+				Mode:  "keyset",
+				Sort:  sqlstorage.EmployeesByID,
+				Limit: employeesDefaultLimit,
+			}
+		}
+
+		switch data.Page.Mode {
+		case "offset":
+			count, err := store.CountEmployees(r.Context())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			data.LastOffset = max(int(count)-data.Page.Limit, 0)
+		case "keyset":
+			data.LastCursor = cursors.encode(employeeCursor{Sort: data.Page.Sort, Backward: true})
+		}
+
+		w.Header().Add("Content-Type", "text/html")
+		if err := t.Execute(w, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
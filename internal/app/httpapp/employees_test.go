@@ -0,0 +1,76 @@
+package httpapp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"de/internal/storage/sqlstorage"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCursorSigner(t *testing.T) {
+	cs, err := newCursorSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursors := []employeeCursor{
+		{Sort: sqlstorage.EmployeesByID},
+		{Sort: sqlstorage.EmployeesByID, Key: &sqlstorage.EmployeeKey{ID: 42}},
+		{Sort: sqlstorage.EmployeesByName, Key: &sqlstorage.EmployeeKey{ID: 7, Name: "777"}, Backward: true},
+	}
+	for _, c := range cursors {
+		got, err := cs.decode(cs.encode(c))
+		if err != nil {
+			t.Errorf("decode(encode(%+v)): %v", c, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c) {
+			t.Errorf("decode(encode(%+v)) = %+v", c, got)
+		}
+	}
+}
+
+func TestCursorSignerRejects(t *testing.T) {
+	cs, err := newCursorSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newCursorSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := employeeCursor{Sort: sqlstorage.EmployeesByID, Key: &sqlstorage.EmployeeKey{ID: 42}}
+	token := cs.encode(c)
+	payload, sum, _ := strings.Cut(token, ".")
+	enc := base64.RawURLEncoding
+	forged := enc.EncodeToString([]byte(`{"s":"id","k":{"id":1}}`)) + "." + sum
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"no signature", payload},
+		{"signature of another payload", forged},
+		{"signed with another key", other.encode(c)},
+		{"payload not base64", "!!!." + sum},
+		{"signature not base64", payload + ".!!!"},
+		{"truncated signature", payload + "." + sum[:len(sum)-2]},
+		{"signed payload that is no cursor", func() string {
+			mac := hmac.New(sha256.New, cs.key)
+			mac.Write([]byte("not json"))
+			return enc.EncodeToString([]byte("not json")) + "." + enc.EncodeToString(mac.Sum(nil))
+		}()},
+	}
+
+	for _, tt := range tests {
+		if _, err := cs.decode(tt.token); !errors.Is(err, errInvalidCursor) {
+			t.Errorf("%s: decode(%q) = %v, want %v", tt.name, tt.token, err, errInvalidCursor)
+		}
+	}
+}
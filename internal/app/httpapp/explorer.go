@@ -0,0 +1,95 @@
+package httpapp
+
+import (
+	"de/internal/core"
+	"de/internal/storage/sqlstorage"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+)
+
+// explorerMaxSchedules bounds the interleavings run for a single report.
+const explorerMaxSchedules = 200
+
+func handleExplorerPage(store *sqlstorage.Store, sims *simRegistry) http.HandlerFunc {
+	type tdata struct {
+		Error      string
+		Isolations []string
+		Isolation  string
+		Tx1, Tx2   string
+		Limit      int
+		Report     *core.ExploreReport
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := requestStore(r, store)
+		t, err := template.ParseFiles(
+			"templates/base.tmpl.html",
+			"templates/explorer.tmpl.html",
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := tdata{
+			Isolations: isolationNames,
+			Isolation:  "read-committed",
+			Tx1:        "read\nupdate 1 15\ncommit",
+			Tx2:        "read\nupdate 1 25\ncommit",
+			Limit:      50,
+		}
+
+		if r.Method == http.MethodPost {
+			data.Isolation = r.FormValue("isolation")
+			data.Tx1 = r.FormValue("tx1")
+			data.Tx2 = r.FormValue("tx2")
+			data.Limit, _ = strconv.Atoi(r.FormValue("limit"))
+			data.Limit = min(max(data.Limit, 1), explorerMaxSchedules)
+
+			report, err := explore(r, store, sims, data.Isolation, data.Tx1, data.Tx2, data.Limit)
+			if err != nil {
+				data.Error = err.Error()
+			} else {
+				data.Report = &report
+			}
+		}
+
+		w.Header().Add("Content-Type", "text/html")
+		if err := t.Execute(w, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func explore(
+	r *http.Request,
+	store *sqlstorage.Store,
+	sims *simRegistry,
+	isolation, script1, script2 string,
+	limit int,
+) (core.ExploreReport, error) {
+	level, err := core.ParseIsolationLevel(isolation)
+	if err != nil {
+		return core.ExploreReport{}, err
+	}
+
+	tx1, err := core.ParseSaleScript(script1)
+	if err != nil {
+		return core.ExploreReport{}, fmt.Errorf("tx1: %v", err)
+	}
+	tx2, err := core.ParseSaleScript(script2)
+	if err != nil {
+		return core.ExploreReport{}, fmt.Errorf("tx2: %v", err)
+	}
+
+	ctx, release, err := sims.register(r.Context(), clientID(r), "schedule explorer")
+	if err != nil {
+		return core.ExploreReport{}, err
+	}
+	defer release()
+
+	return core.ExploreSchedules(ctx, store, level, tx1, tx2, limit)
+}
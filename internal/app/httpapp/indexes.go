@@ -0,0 +1,169 @@
+package httpapp
+
+import (
+	"context"
+	"de/internal/core"
+	"de/internal/storage/sqlstorage"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Runs of each catalog query timed around an index change, the median is
+// shown.
+const (
+	indexTimingRuns   = 3
+	indexTimingWarmup = 1
+)
+
+type catalogCategory struct {
+	Name  sqlstorage.QueryCategory
+	Cases []catalogAnalysis
+}
+
+type catalogAnalysis struct {
+	sqlstorage.QueryCase
+	Query  string
+	Before catalogResult
+	// After is the analysis once the indexes changed, if they did.
+	After *catalogResult
+}
+
+type catalogResult struct {
+	Analysis sqlstorage.Plan
+	Error    string
+	// Latency is the median of a few runs, zero when not timed.
+	Latency time.Duration
+	// Differences tell how the plan differs from the one of the case the
+	// query is paired with.
+	Differences []string
+}
+
+// analyzeCatalog analyzes every query of the catalog, timing the ones that
+// read the table as well unless it is empty. A case failing, on a dialect it
+// was not written for say, is shown next to the others instead of failing the
+// page.
+func analyzeCatalog(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	table string,
+) []catalogCategory {
+	var latencies map[string]time.Duration
+	if table != "" {
+		latencies = timeCatalog(ctx, store, table)
+	}
+
+	var categories []catalogCategory
+	for _, c := range sqlstorage.QueryCatalog {
+		a := catalogAnalysis{QueryCase: c, Query: c.Query(store.Dialect)}
+		var err error
+		if a.Before.Analysis, err = store.AnalyzeCase(ctx, c); err != nil {
+			a.Before.Error = err.Error()
+		}
+		a.Before.Latency = latencies[c.Name]
+
+		if n := len(categories); n == 0 || categories[n-1].Name != c.Category {
+			categories = append(categories, catalogCategory{Name: c.Category})
+		}
+		last := &categories[len(categories)-1]
+		last.Cases = append(last.Cases, a)
+	}
+
+	analyses := map[string]*catalogAnalysis{}
+	for i := range categories {
+		for j := range categories[i].Cases {
+			a := &categories[i].Cases[j]
+			analyses[a.Name] = a
+		}
+	}
+	for _, a := range analyses {
+		pair, ok := analyses[a.Pair]
+		if !ok || a.Before.Error != "" || pair.Before.Error != "" {
+			continue
+		}
+		a.Before.Differences = sqlstorage.ComparePlans(
+			a.Label, a.Before.Analysis,
+			pair.Label, pair.Before.Analysis,
+		)
+	}
+	return categories
+}
+
+// timeCatalog returns the median latency of the catalog queries reading the
+// table by name, the ones that failed are left out.
+func timeCatalog(ctx context.Context, store *sqlstorage.Store, table string) map[string]time.Duration {
+	var cases []sqlstorage.QueryCase
+	for _, c := range sqlstorage.QueryCatalog {
+		if c.Reads(store.Dialect, table) {
+			cases = append(cases, c)
+		}
+	}
+	if len(cases) == 0 {
+		return nil
+	}
+
+	results, _ := core.BenchmarkQueries(ctx, store, core.QueryBenchConfig{
+		Cases:       cases,
+		Runs:        indexTimingRuns,
+		Warmup:      indexTimingWarmup,
+		Concurrency: 1,
+	})
+
+	latencies := map[string]time.Duration{}
+	for _, r := range results {
+		if r.Error == "" {
+			latencies[r.Case] = r.P50
+		}
+	}
+	return latencies
+}
+
+// changeIndexes creates or drops the index of the form and analyzes the
+// catalog before and after, it returns the comparison and a description of
+// the change.
+func changeIndexes(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	r *http.Request,
+) ([]catalogCategory, string, error) {
+	var change func() error
+	var description string
+	table := r.FormValue("table")
+	name := strings.TrimSpace(r.FormValue("name"))
+
+	switch r.FormValue("action") {
+	case "create":
+		index := sqlstorage.Index{
+			Table:  table,
+			Name:   name,
+			Unique: r.FormValue("unique") != "",
+		}
+		for _, c := range strings.Split(r.FormValue("columns"), ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				index.Columns = append(index.Columns, c)
+			}
+		}
+		change = func() error { return store.CreateIndex(ctx, index) }
+		description = fmt.Sprintf("created index %s on %s (%s)", name, table, strings.Join(index.Columns, ", "))
+	case "drop":
+		change = func() error { return store.DropIndex(ctx, table, name) }
+		description = fmt.Sprintf("dropped index %s of %s", name, table)
+	default:
+		return nil, "", errors.New("unknown index action")
+	}
+
+	before := analyzeCatalog(ctx, store, table)
+	if err := change(); err != nil {
+		return nil, "", err
+	}
+	after := analyzeCatalog(ctx, store, table)
+
+	for i := range before {
+		for j := range before[i].Cases {
+			before[i].Cases[j].After = &after[i].Cases[j].Before
+		}
+	}
+	return before, description, nil
+}
@@ -1,8 +1,14 @@
 package httpapp
 
 import (
+	"context"
 	"de/internal/core"
+	"de/internal/core/serializability"
+	"de/internal/storage/runstorage"
 	"de/internal/storage/sqlstorage"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
@@ -10,23 +16,67 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-func handleIsolation(store *sqlstorage.Store) http.HandlerFunc {
+var isolationScenarios = map[uint64]core.SaleScenario{
+	1: core.DirtyReadScenario,
+	2: core.NonRepeatableReadScenario,
+	3: core.PhantomReadScenario,
+	4: core.LostUpdateScenario,
+	5: core.NextKeyLockScenario,
+	6: core.CascadingAbortScenario,
+	7: core.ThreeWayDeadlockScenario,
+	8: core.ReadOnlyAnomalyScenario,
+	9: core.OptimisticUpdateScenario,
+}
+
+// Commands the client sends to control a running simulation.
+const (
+	simNext     = "next"
+	simPrev     = "prev"
+	simPause    = "pause"
+	simRunToEnd = "run-to-end"
+	simAbort    = "abort"
+)
+
+// simStartPayload starts a simulation of a scenario or, when Run is set,
+// replays a run from the history. Isolation, one of the keys of
+// core.IsolationLevels, overrides the level of the scenario.
+type simStartPayload struct {
+	SimType   uint64 `json:"scenario"`
+	Isolation string `json:"isolation,omitempty"`
+	Run       int64  `json:"run"`
+}
+
+type simCommandPayload struct {
+	Cmd string `json:"cmd"`
+}
+
+type simExportPayload struct {
+	Format core.ExportFormat `json:"format"`
+	Text   string            `json:"text,omitempty"`
+}
+
+type simDonePayload struct {
+	Steps   int           `json:"steps"`
+	Aborted bool          `json:"aborted"`
+	Verdict *core.Verdict `json:"verdict,omitempty"`
+	// Serializability is the conflict graph of the transactions that ran.
+	Serializability *serializability.Report `json:"serializability,omitempty"`
+	// Run is the id the run was saved to the history under.
+	Run int64 `json:"run,omitempty"`
+}
+
+func handleIsolation(
+	store *sqlstorage.Store,
+	runs *runstorage.Store,
+	sims *simRegistry,
+) http.HandlerFunc {
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
 	}
 
-	type simResult struct {
-		TxID  string            `json:"tx"`
-		Query string            `json:"query"`
-		Sales []sqlstorage.Sale `json:"sales"`
-	}
-	var message struct {
-		SimType  uint64 `json:"type"`
-		Quantity uint64 `json:"qty"`
-	}
-
 	return func(w http.ResponseWriter, r *http.Request) {
+		store := requestStore(r, store)
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			log.Println(err)
@@ -35,43 +85,327 @@ func handleIsolation(store *sqlstorage.Store) http.HandlerFunc {
 
 		defer conn.Close()
 
-		if err := conn.ReadJSON(&message); err != nil {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		keepAlive(conn, ctx.Done())
+		msgs := readMessages(conn, ctx.Done(), cancel)
+
+		sess := &simSession{
+			store:  store,
+			runs:   runs,
+			sims:   sims,
+			client: clientID(r),
+			conn:   conn,
+		}
+		defer sess.stop()
+
+		if err := sess.serve(ctx, msgs); err != nil {
 			log.Println(err)
-			return
 		}
+	}
+}
 
-		var states []core.SaleSimulation
-		ctx := r.Context()
-		switch message.SimType {
-		case 1:
-			states, err = core.SimulateDirtyRead(ctx, store)
-		case 2:
-			states, err = core.SimulateNonRepeatableRead(ctx, store)
-		case 3:
-			states, err = core.SimulatePhantomRead(ctx, store)
-		case 4:
-			log.Println(4)
-			states, err = core.SimulateLostUpdates(ctx, store)
-		default:
-			return
+// simSession holds the state of the simulation running on a single
+// connection. Only one simulation runs at a time, starting another one ends
+// the current one. Finished runs are saved to the history and can be replayed
+// by stepping through their recorded states.
+//
+// Running simulations are registered so their number stays bounded, a
+// simulation cancelled through the registry is stopped like an aborted one.
+//
+// Errors returned by its methods mean the connection is unusable, anything
+// the client should be told about is sent as an error message instead.
+type simSession struct {
+	store  *sqlstorage.Store
+	runs   *runstorage.Store
+	sims   *simRegistry
+	client string
+	conn   *websocket.Conn
+
+	sim    *core.SaleSimulator
+	run    core.SaleRun
+	cursor int
+	replay bool
+	// cancelled is closed when the registry cancels the simulation, release
+	// unregisters it.
+	cancelled <-chan struct{}
+	release   func()
+
+	ticker *time.Ticker
+	tick   <-chan time.Time
+}
+
+func (s *simSession) serve(ctx context.Context, msgs <-chan wsInbound) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.tick:
+			if err := s.next(ctx); err != nil {
+				return err
+			}
+		case <-s.cancelled:
+			if err := s.cancel(); err != nil {
+				return err
+			}
+		case in, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			if in.Err != nil {
+				if err := writeError(s.conn, in.Err); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := s.handle(ctx, in.Msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *simSession) handle(ctx context.Context, msg wsMessage) error {
+	switch msg.Type {
+	case wsPing:
+		return writeMessage(s.conn, wsPong, nil)
+	case wsStart:
+		var payload simStartPayload
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			return writeError(s.conn, fmt.Errorf("decode start: %v", err))
+		}
+		if payload.Run != 0 {
+			return s.startReplay(ctx, payload.Run)
+		}
+		return s.start(ctx, payload.SimType, payload.Isolation)
+	case wsCommand:
+		var payload simCommandPayload
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			return writeError(s.conn, fmt.Errorf("decode command: %v", err))
+		}
+		return s.command(ctx, payload.Cmd)
+	case wsExport:
+		var payload simExportPayload
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			return writeError(s.conn, fmt.Errorf("decode export: %v", err))
 		}
+		return s.export(payload.Format)
+	}
+
+	return writeError(s.conn, fmt.Errorf("unknown message type %q", msg.Type))
+}
+
+func (s *simSession) start(ctx context.Context, simType uint64, isolation string) error {
+	scenario, ok := isolationScenarios[simType]
+	if !ok {
+		return writeError(s.conn, fmt.Errorf("unknown simulation type %d", simType))
+	}
+	if isolation != "" {
+		level, err := core.ParseIsolationLevel(isolation)
 		if err != nil {
-			log.Println(err)
-			return
+			return writeError(s.conn, err)
 		}
+		scenario.Isolation = level
+	}
 
-		if err := store.Refresh(ctx); err != nil {
-			log.Println(err)
-			return
+	s.stop()
+
+	simCtx, release, err := s.sims.register(ctx, s.client, scenario.Name)
+	if err != nil {
+		return writeError(s.conn, err)
+	}
+
+	sim, err := core.NewSaleSimulator(simCtx, s.store, scenario)
+	if err != nil {
+		release()
+		return writeError(s.conn, err)
+	}
+
+	s.sim = sim
+	s.cancelled = simCtx.Done()
+	s.release = release
+	s.run = core.NewSaleRun(string(s.store.Dialect), scenario)
+	s.run.States = []core.SaleSimulation{sim.Explanation()}
+	s.cursor = 0
+	s.replay = false
+	return writeMessage(s.conn, wsState, s.run.States[s.cursor])
+}
+
+func (s *simSession) startReplay(ctx context.Context, id int64) error {
+	run, err := s.runs.GetRun(ctx, id)
+	if err != nil {
+		return writeError(s.conn, err)
+	}
+	if len(run.States) == 0 {
+		return writeError(s.conn, fmt.Errorf("run %d has no states", id))
+	}
+
+	s.stop()
+
+	s.run = run
+	s.cursor = 0
+	s.replay = true
+	return writeMessage(s.conn, wsState, s.run.States[s.cursor])
+}
+
+func (s *simSession) command(ctx context.Context, cmd string) error {
+	if s.run.States == nil {
+		return writeError(s.conn, errors.New("no simulation has been started"))
+	}
+
+	switch cmd {
+	case simNext:
+		s.pause()
+		return s.next(ctx)
+	case simPrev:
+		s.pause()
+		if s.cursor > 0 {
+			s.cursor -= 1
+			return writeMessage(s.conn, wsState, s.run.States[s.cursor])
 		}
+	case simPause:
+		s.pause()
+	case simRunToEnd:
+		if s.ticker == nil {
+			s.ticker = time.NewTicker(time.Second)
+			s.tick = s.ticker.C
+		}
+	case simAbort:
+		if s.sim != nil {
+			return s.abort()
+		}
+	default:
+		return writeError(s.conn, fmt.Errorf("unknown command %q", cmd))
+	}
 
-		for _, st := range states {
-			if err := ctx.Err(); err != nil {
-				return
-			}
+	return nil
+}
+
+// export renders the states executed so far in the requested format.
+func (s *simSession) export(format core.ExportFormat) error {
+	if s.run.States == nil {
+		return writeError(s.conn, errors.New("no simulation has been started"))
+	}
+
+	text, err := s.run.Export(format)
+	if err != nil {
+		return writeError(s.conn, err)
+	}
+
+	return writeMessage(s.conn, wsExport, simExportPayload{
+		Format: format,
+		Text:   text,
+	})
+}
+
+// next moves forward through the states that have already been executed,
+// stepping past the last one executes the next step of the scenario.
+func (s *simSession) next(ctx context.Context) error {
+	if s.cursor < len(s.run.States)-1 {
+		s.cursor += 1
+		if err := writeMessage(s.conn, wsState, s.run.States[s.cursor]); err != nil {
+			return err
+		}
+		if !s.replay || s.cursor < len(s.run.States)-1 {
+			return nil
+		}
+		s.pause()
+		return writeMessage(s.conn, wsDone, simDonePayload{
+			Steps:           len(s.run.States) - 1,
+			Aborted:         s.run.Aborted,
+			Verdict:         s.run.Verdict,
+			Run:             s.run.ID,
+			Serializability: s.run.Serializability,
+		})
+	}
 
-			conn.WriteJSON(st)
-			time.Sleep(time.Second)
+	if s.sim == nil {
+		s.pause()
+		return nil
+	}
+
+	states, err := s.sim.Next(ctx)
+	if err != nil {
+		s.stop()
+		return writeError(s.conn, err)
+	}
+	for _, st := range states {
+		s.run.States = append(s.run.States, st)
+		s.cursor += 1
+		if err := writeMessage(s.conn, wsState, st); err != nil {
+			return err
 		}
 	}
+
+	if !s.sim.Done() {
+		return nil
+	}
+
+	verdict := s.sim.Verdict()
+	s.run.Verdict = &verdict
+	report := serializability.Check(s.sim.History())
+	s.run.Serializability = &report
+	s.stop()
+	return writeMessage(s.conn, wsDone, simDonePayload{
+		Steps:           len(s.run.States) - 1,
+		Verdict:         &verdict,
+		Run:             s.run.ID,
+		Serializability: &report,
+	})
+}
+
+// abort stops the running simulation and tells the client it was aborted.
+func (s *simSession) abort() error {
+	s.stop()
+	return writeMessage(s.conn, wsDone, simDonePayload{
+		Steps:   len(s.run.States) - 1,
+		Aborted: true,
+		Run:     s.run.ID,
+	})
+}
+
+// cancel aborts a simulation cancelled through the registry, when the
+// server shuts down.
+func (s *simSession) cancel() error {
+	s.cancelled = nil
+	if s.sim == nil {
+		return nil
+	}
+	if err := writeError(s.conn, errors.New("the simulation was cancelled by the server")); err != nil {
+		return err
+	}
+	return s.abort()
+}
+
+func (s *simSession) pause() {
+	if s.ticker != nil {
+		s.ticker.Stop()
+		s.ticker, s.tick = nil, nil
+	}
+}
+
+// stop ends the running simulation, rolling back its open transactions,
+// dropping its scratch table and saving the run to the history. The executed
+// states are kept so the client can still step through them.
+func (s *simSession) stop() {
+	s.pause()
+	if s.sim == nil {
+		return
+	}
+
+	s.run.Aborted = !s.sim.Done()
+	if err := s.sim.Close(); err != nil {
+		log.Println(err)
+	}
+	s.sim = nil
+	s.release()
+	s.cancelled, s.release = nil, nil
+
+	s.run.Finished = time.Now()
+	id, err := s.runs.SaveRun(context.Background(), s.run)
+	if err != nil {
+		log.Println(err)
+	}
+	s.run.ID = id
 }
@@ -0,0 +1,92 @@
+package httpapp
+
+import (
+	"de/internal/core"
+	"de/internal/storage/sqlstorage"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Bounds of the job queue runs, each strategy runs for at most
+// jobsTimeout so a request holds its workers for 20 seconds at the most.
+const (
+	jobsMaxJobs     = 500
+	jobsMaxWorkers  = 16
+	jobsMaxWorkTime = 100 * time.Millisecond
+	jobsTimeout     = 5 * time.Second
+)
+
+func handleJobsPage(store *sqlstorage.Store, sims *simRegistry) http.HandlerFunc {
+	type strategy struct {
+		Name  sqlstorage.ClaimStrategy
+		Query string
+	}
+
+	type tdata struct {
+		Error      string
+		Strategies []strategy
+		Jobs       int
+		Workers    int
+		WorkTime   time.Duration
+		Results    []core.JobQueueResult
+	}
+
+	var strategies []strategy
+	for _, s := range sqlstorage.ClaimStrategies {
+		strategies = append(strategies, strategy{
+			Name:  s,
+			Query: "SELECT id FROM jobs WHERE status = 'pending' ORDER BY id LIMIT 1" + s.Clause(),
+		})
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := requestStore(r, store)
+		t, err := template.ParseFiles(
+			"templates/base.tmpl.html",
+			"templates/jobs.tmpl.html",
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := tdata{
+			Strategies: strategies,
+			Jobs:       200,
+			Workers:    8,
+			WorkTime:   5 * time.Millisecond,
+		}
+
+		if r.Method == http.MethodPost {
+			data.Jobs, _ = strconv.Atoi(r.FormValue("jobs"))
+			data.Jobs = min(max(data.Jobs, 1), jobsMaxJobs)
+			data.Workers, _ = strconv.Atoi(r.FormValue("workers"))
+			data.Workers = min(max(data.Workers, 1), jobsMaxWorkers)
+			data.WorkTime, _ = time.ParseDuration(r.FormValue("work"))
+			data.WorkTime = min(max(data.WorkTime, 0), jobsMaxWorkTime)
+
+			ctx, release, err := sims.register(r.Context(), clientID(r), "job queue")
+			if err == nil {
+				data.Results, err = core.RunJobQueue(ctx, store, core.JobQueueConfig{
+					Strategies: sqlstorage.ClaimStrategies,
+					Jobs:       data.Jobs,
+					Workers:    data.Workers,
+					WorkTime:   data.WorkTime,
+					Timeout:    jobsTimeout,
+				})
+				release()
+			}
+			if err != nil {
+				data.Error = err.Error()
+			}
+		}
+
+		w.Header().Add("Content-Type", "text/html")
+		if err := t.Execute(w, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
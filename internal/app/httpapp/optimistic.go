@@ -0,0 +1,149 @@
+package httpapp
+
+import (
+	"context"
+	"de/internal/core"
+	"de/internal/storage/sqlstorage"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Caps on the clients, the duration and the row counts a visitor can ask of
+// the update benchmark.
+const (
+	optimisticMaxClients  = 32
+	optimisticMaxDuration = 3 * time.Second
+	optimisticMaxLevels   = 4
+	optimisticMaxRows     = 256
+)
+
+// lessonRun is a scenario run to completion for a page to show.
+type lessonRun struct {
+	Scenario core.SaleScenario
+	States   []core.SaleSimulation
+	Verdict  core.Verdict
+}
+
+func handleOptimisticPage(store *sqlstorage.Store, sims *simRegistry) http.HandlerFunc {
+	type tdata struct {
+		Error    string
+		Runs     []lessonRun
+		Clients  int
+		Duration time.Duration
+		Rows     string
+		Results  []core.UpdateBenchResult
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := requestStore(r, store)
+		t, err := template.ParseFiles(
+			"templates/base.tmpl.html",
+			"templates/optimistic.tmpl.html",
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := tdata{
+			Clients:  8,
+			Duration: time.Second,
+			Rows:     "1, 4, 16, 64",
+		}
+
+		// The lessons run on every visit and the benchmark on top of them,
+		// both count against the limits of the simulations.
+		ctx, release, err := sims.register(r.Context(), clientID(r), "optimistic locking")
+		if err == nil {
+			defer release()
+			for _, scenario := range []core.SaleScenario{
+				core.LostUpdateScenario,
+				core.OptimisticUpdateScenario,
+			} {
+				var run lessonRun
+				if run, err = runLesson(ctx, store, scenario); err != nil {
+					break
+				}
+				data.Runs = append(data.Runs, run)
+			}
+		}
+
+		if err == nil && r.Method == http.MethodPost {
+			data.Clients, _ = strconv.Atoi(r.FormValue("clients"))
+			data.Clients = min(max(data.Clients, 1), optimisticMaxClients)
+			data.Duration, _ = time.ParseDuration(r.FormValue("duration"))
+			data.Duration = min(max(data.Duration, 100*time.Millisecond), optimisticMaxDuration)
+			data.Rows = r.FormValue("rows")
+
+			data.Results, err = benchUpdates(ctx, store, data.Clients, data.Duration, data.Rows)
+		}
+		if err != nil {
+			data.Error = err.Error()
+		}
+
+		w.Header().Add("Content-Type", "text/html")
+		if err := t.Execute(w, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func runLesson(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	scenario core.SaleScenario,
+) (lessonRun, error) {
+	sim, err := core.NewSaleSimulator(ctx, store, scenario)
+	if err != nil {
+		return lessonRun{}, err
+	}
+	defer sim.Close()
+
+	run := lessonRun{Scenario: scenario}
+	for !sim.Done() {
+		states, err := sim.Next(ctx)
+		if err != nil {
+			return lessonRun{}, err
+		}
+		run.States = append(run.States, states...)
+	}
+	run.Verdict = sim.Verdict()
+	return run, nil
+}
+
+func benchUpdates(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	clients int,
+	duration time.Duration,
+	rows string,
+) ([]core.UpdateBenchResult, error) {
+	cfg := core.UpdateBenchConfig{
+		Strategies: core.UpdateStrategies,
+		Clients:    clients,
+		Duration:   duration,
+		Isolation:  core.IsolationLevels["read-committed"],
+		MaxRetries: 100,
+		Seed:       time.Now().UnixNano(),
+	}
+	for _, f := range strings.FieldsFunc(rows, func(r rune) bool { return r == ',' || r == ' ' }) {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, err
+		}
+		if n < 1 || n > optimisticMaxRows {
+			return nil, fmt.Errorf("a contention level is from 1 to %d rows, not %d", optimisticMaxRows, n)
+		}
+		cfg.Rows = append(cfg.Rows, n)
+	}
+	if len(cfg.Rows) > optimisticMaxLevels {
+		cfg.Rows = cfg.Rows[:optimisticMaxLevels]
+	}
+
+	return core.BenchmarkUpdates(ctx, store, cfg)
+}
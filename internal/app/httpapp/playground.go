@@ -0,0 +1,99 @@
+package httpapp
+
+import (
+	"de/internal/storage/sqlstorage"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+var playgroundLimits = sqlstorage.PlaygroundLimits{
+	Timeout: 5 * time.Second,
+	MaxRows: 50,
+}
+
+const playgroundExample = "SELECT id, name FROM employees WHERE name = '777'"
+
+func handlePlaygroundPage(store *sqlstorage.Store) http.HandlerFunc {
+	type tdata struct {
+		Error       string
+		Query       string
+		Limits      sqlstorage.PlaygroundLimits
+		Explanation *sqlstorage.Explanation
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := requestStore(r, store)
+		t, err := template.ParseFiles(
+			"templates/base.tmpl.html",
+			"templates/playground.tmpl.html",
+			"templates/plan.tmpl.html",
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := tdata{Query: playgroundExample, Limits: playgroundLimits}
+		if r.Method == http.MethodPost {
+			data.Query = r.FormValue("query")
+			e, err := store.Explain(r.Context(), data.Query, playgroundLimits)
+			if err != nil {
+				data.Error = err.Error()
+			} else {
+				data.Explanation = &e
+			}
+		}
+
+		w.Header().Add("Content-Type", "text/html")
+		if err := t.Execute(w, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// handleExplain explains the query of a JSON request body of the form
+// {"query": "SELECT ..."}.
+func handleExplain(store *sqlstorage.Store) http.HandlerFunc {
+	type request struct {
+		Query string `json:"query"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := requestStore(r, store)
+		var req request
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			explainError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		e, err := store.Explain(r.Context(), req.Query, playgroundLimits)
+		switch {
+		case errors.Is(err, sqlstorage.ErrQueryTimeout):
+			explainError(w, err, http.StatusGatewayTimeout)
+			return
+		case err != nil:
+			// The query is at fault for the most part, a syntax error or an
+			// unknown table.
+			explainError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(e); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func explainError(w http.ResponseWriter, err error, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
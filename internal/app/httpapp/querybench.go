@@ -0,0 +1,255 @@
+package httpapp
+
+import (
+	"de/internal/core"
+	"de/internal/storage/sqlstorage"
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Highest runs, warmup runs and clients the benchmarks page accepts, the
+// bench queries command takes any.
+const (
+	queryBenchMaxRuns        = 200
+	queryBenchMaxWarmup      = 20
+	queryBenchMaxConcurrency = 16
+)
+
+// Geometry of the latency chart, in pixels.
+const (
+	chartLabelWidth = 260
+	chartBarsWidth  = 480
+	chartRowHeight  = 42
+	chartBarHeight  = 12
+	chartAxisHeight = 24
+
+	histogramWidth  = 160
+	histogramHeight = 32
+)
+
+// latencyPercentiles are drawn for each query, with their color.
+var latencyPercentiles = []struct {
+	Name  string
+	Color string
+	Of    func(core.QueryBenchResult) time.Duration
+}{
+	{"p50", "#4e79a7", func(r core.QueryBenchResult) time.Duration { return r.P50 }},
+	{"p90", "#f28e2b", func(r core.QueryBenchResult) time.Duration { return r.P90 }},
+	{"p99", "#e15759", func(r core.QueryBenchResult) time.Duration { return r.P99 }},
+}
+
+// latencyChart compares the latency percentiles of the queries with bars on
+// a logarithmic scale, the latencies span several orders of magnitude.
+type latencyChart struct {
+	Width      int
+	Height     int
+	LabelWidth int
+	Rows       []chartRow
+	Ticks      []chartTick
+	Legend     []chartBar
+}
+
+type chartRow struct {
+	Y     int
+	Label string
+	Error string
+	Bars  []chartBar
+}
+
+type chartBar struct {
+	X, Y, Width, Height int
+	Color               string
+	Title               string
+}
+
+type chartTick struct {
+	X     int
+	Label string
+}
+
+func newLatencyChart(results []core.QueryBenchResult) latencyChart {
+	c := latencyChart{
+		Width:      chartLabelWidth + chartBarsWidth + 20,
+		Height:     len(results)*chartRowHeight + chartAxisHeight,
+		LabelWidth: chartLabelWidth,
+	}
+
+	// The scale spans the decades from the fastest percentile to the
+	// slowest.
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, r := range results {
+		if r.Error != "" {
+			continue
+		}
+		for _, p := range latencyPercentiles {
+			d := math.Log10(float64(max(p.Of(r), time.Microsecond)))
+			lo, hi = math.Min(lo, d), math.Max(hi, d)
+		}
+	}
+	if math.IsInf(lo, 0) {
+		return c
+	}
+	lo, hi = math.Floor(lo), math.Ceil(hi)
+	if hi == lo {
+		hi++
+	}
+	x := func(d time.Duration) int {
+		v := math.Log10(float64(max(d, time.Microsecond)))
+		return chartLabelWidth + int((v-lo)/(hi-lo)*chartBarsWidth)
+	}
+
+	for e := lo; e <= hi; e++ {
+		d := time.Duration(math.Pow(10, e))
+		c.Ticks = append(c.Ticks, chartTick{X: x(d), Label: d.String()})
+	}
+
+	for i, r := range results {
+		row := chartRow{Y: i * chartRowHeight, Label: r.Label, Error: r.Error}
+		if r.Error == "" {
+			for j, p := range latencyPercentiles {
+				d := p.Of(r)
+				row.Bars = append(row.Bars, chartBar{
+					X:      chartLabelWidth,
+					Y:      row.Y + 3 + j*chartBarHeight,
+					Width:  max(x(d)-chartLabelWidth, 1),
+					Height: chartBarHeight - 1,
+					Color:  p.Color,
+					Title:  p.Name + " " + d.Round(time.Microsecond).String(),
+				})
+			}
+		}
+		c.Rows = append(c.Rows, row)
+	}
+
+	for i, p := range latencyPercentiles {
+		c.Legend = append(c.Legend, chartBar{X: i * 60, Color: p.Color, Title: p.Name})
+	}
+	return c
+}
+
+// latencyHistogram draws the histogram of a query's latencies.
+type latencyHistogram struct {
+	Width  int
+	Height int
+	Bars   []chartBar
+}
+
+func newLatencyHistogram(r core.QueryBenchResult) latencyHistogram {
+	h := latencyHistogram{Width: histogramWidth, Height: histogramHeight}
+	top := 0
+	for _, b := range r.Histogram {
+		top = max(top, b.Count)
+	}
+	if top == 0 {
+		return h
+	}
+
+	width := histogramWidth / len(r.Histogram)
+	for i, b := range r.Histogram {
+		height := b.Count * histogramHeight / top
+		h.Bars = append(h.Bars, chartBar{
+			X:      i * width,
+			Y:      histogramHeight - height,
+			Width:  max(width-1, 1),
+			Height: height,
+			Color:  latencyPercentiles[0].Color,
+			Title:  strconv.Itoa(b.Count) + " run(s) up to " + b.Upper.Round(time.Microsecond).String(),
+		})
+	}
+	return h
+}
+
+func handleQueryBenchPage(store *sqlstorage.Store, sims *simRegistry) http.HandlerFunc {
+	type result struct {
+		core.QueryBenchResult
+		Histogram latencyHistogram
+	}
+
+	type tdata struct {
+		Error       string
+		Categories  []sqlstorage.QueryCategory
+		Category    sqlstorage.QueryCategory
+		Runs        int
+		Warmup      int
+		Concurrency int
+		Chart       *latencyChart
+		Results     []result
+	}
+
+	var categories []sqlstorage.QueryCategory
+	for _, c := range sqlstorage.QueryCatalog {
+		if len(categories) == 0 || categories[len(categories)-1] != c.Category {
+			categories = append(categories, c.Category)
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := requestStore(r, store)
+		t, err := template.ParseFiles(
+			"templates/base.tmpl.html",
+			"templates/querybench.tmpl.html",
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := tdata{
+			Categories:  categories,
+			Category:    sqlstorage.PaginationQueries,
+			Runs:        20,
+			Warmup:      2,
+			Concurrency: 1,
+		}
+
+		if r.Method == http.MethodPost {
+			data.Category = sqlstorage.QueryCategory(r.FormValue("category"))
+			data.Runs, _ = strconv.Atoi(r.FormValue("runs"))
+			data.Runs = min(max(data.Runs, 1), queryBenchMaxRuns)
+			data.Warmup, _ = strconv.Atoi(r.FormValue("warmup"))
+			data.Warmup = min(max(data.Warmup, 0), queryBenchMaxWarmup)
+			data.Concurrency, _ = strconv.Atoi(r.FormValue("concurrency"))
+			data.Concurrency = min(max(data.Concurrency, 1), queryBenchMaxConcurrency)
+
+			cfg := core.QueryBenchConfig{
+				Runs:        data.Runs,
+				Warmup:      data.Warmup,
+				Concurrency: data.Concurrency,
+			}
+			for _, c := range sqlstorage.QueryCatalog {
+				if c.Category == data.Category {
+					cfg.Cases = append(cfg.Cases, c)
+				}
+			}
+
+			var results []core.QueryBenchResult
+			ctx, release, err := sims.register(r.Context(), clientID(r), "query benchmark")
+			if err == nil {
+				results, err = core.BenchmarkQueries(ctx, store, cfg)
+				release()
+			}
+			if err != nil {
+				data.Error = err.Error()
+			}
+			if len(results) > 0 {
+				chart := newLatencyChart(results)
+				data.Chart = &chart
+			}
+			for _, res := range results {
+				data.Results = append(data.Results, result{
+					QueryBenchResult: res,
+					Histogram:        newLatencyHistogram(res),
+				})
+			}
+		}
+
+		w.Header().Add("Content-Type", "text/html")
+		if err := t.Execute(w, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -1,24 +1,57 @@
 package httpapp
 
 import (
+	"de/internal/storage/runstorage"
 	"de/internal/storage/sqlstorage"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 )
 
-func routes(store *sqlstorage.Store) chi.Router {
+func routes(
+	store *sqlstorage.Store,
+	runs *runstorage.Store,
+	sessions *sessions,
+	sims *simRegistry,
+	cursors *cursorSigner,
+) chi.Router {
 	mux := chi.NewMux()
 
-	mux.Get("/", handleIndexPage(store))
+	// The routes reading the employees wait for them to be copied into the
+	// sandbox, the others only need its small tables.
+	ifAny := sessions.with(sandboxIfAny)
+	tables := sessions.with(sandboxTables)
+	employees := sessions.with(sandboxEmployees)
+
+	mux.With(ifAny).Get("/", handleIndexPage(store))
 	mux.Route("/ui", func(r chi.Router) {
 		r.Handle("/", http.RedirectHandler("/", http.StatusFound))
 		r.Get("/isolation", handleIsolationPage(store))
-		r.Get("/indices", handleIndexingPage(store))
+		r.With(employees).Get("/indices", handleIndexingPage(store, sims))
+		r.With(employees).Post("/indices", handleIndexingPage(store, sims))
+		r.With(employees).Get("/playground", handlePlaygroundPage(store))
+		r.With(employees).Post("/playground", handlePlaygroundPage(store))
+		r.With(employees).Get("/bench", handleQueryBenchPage(store, sims))
+		r.With(employees).Post("/bench", handleQueryBenchPage(store, sims))
+		r.Get("/console", handleConsolePage(store))
+		r.With(tables).Get("/explorer", handleExplorerPage(store, sims))
+		r.With(tables).Post("/explorer", handleExplorerPage(store, sims))
+		r.With(tables).Get("/optimistic", handleOptimisticPage(store, sims))
+		r.With(tables).Post("/optimistic", handleOptimisticPage(store, sims))
+		r.With(tables).Get("/jobs", handleJobsPage(store, sims))
+		r.With(tables).Post("/jobs", handleJobsPage(store, sims))
+		r.With(employees).Get("/employees", handleEmployeesPage(store, cursors))
+		r.Get("/runs", handleRunsPage(runs))
+		r.Get("/runs/compare", handleRunsComparePage(runs))
 	})
-	mux.Get("/isolation", handleIsolation(store))
-	mux.Post("/refresh", handleRefreshDB(store))
-	mux.Post("/transfer", handleTransfer(store))
+	mux.Get("/api/runs/{id}/export", handleRunExport(runs))
+	mux.Get("/api/simulations", handleSimulations(sims))
+	mux.With(employees).Post("/api/explain", handleExplain(store))
+	mux.With(employees).Get("/api/employees", handleEmployees(store, cursors))
+	mux.With(tables).Get("/isolation", handleIsolation(store, runs, sims))
+	mux.With(employees).Get("/console", handleConsole(store, sims))
+	mux.With(employees).Post("/refresh", handleRefreshDB(store))
+	mux.With(tables).Post("/transfer", handleTransfer(store))
 
 	return mux
 }
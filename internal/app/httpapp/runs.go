@@ -0,0 +1,163 @@
+package httpapp
+
+import (
+	"de/internal/core"
+	"de/internal/storage/runstorage"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func handleRunsPage(runs *runstorage.Store) http.HandlerFunc {
+	type tdata struct {
+		Error string
+		Runs  []core.SaleRun
+		// Newer and Older are the pages either side, 0 when there is none.
+		Newer, Older uint64
+	}
+
+	const pageSize = 50
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, err := template.ParseFiles(
+			"templates/base.tmpl.html",
+			"templates/runs.tmpl.html",
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Pages are numbered from 1 in the query.
+		page, _ := strconv.ParseUint(r.URL.Query().Get("page"), 10, 64)
+		if page > 0 {
+			page -= 1
+		}
+		list, err := runs.ListRuns(r.Context(), pageSize+1, page*pageSize)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := tdata{
+			Error: r.URL.Query().Get("error"),
+			Runs:  list,
+			Newer: page,
+		}
+		if len(list) > pageSize {
+			data.Runs = list[:pageSize]
+			data.Older = page + 2
+		}
+
+		w.Header().Add("Content-Type", "text/html")
+		if err := t.Execute(w, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func handleRunsComparePage(runs *runstorage.Store) http.HandlerFunc {
+	type row struct {
+		Step int
+		A, B *core.SaleSimulation
+	}
+
+	type tdata struct {
+		Error string
+		A, B  core.SaleRun
+		Rows  []row
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, err := template.ParseFiles(
+			"templates/base.tmpl.html",
+			"templates/runs_compare.tmpl.html",
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ctx := r.Context()
+		qp := r.URL.Query()
+		idA, errA := strconv.ParseInt(qp.Get("a"), 10, 64)
+		idB, errB := strconv.ParseInt(qp.Get("b"), 10, 64)
+		if errA != nil || errB != nil {
+			http.Redirect(w, r, "/ui/runs?error=select two runs to compare", http.StatusFound)
+			return
+		}
+
+		a, err := runs.GetRun(ctx, idA)
+		if err != nil {
+			runError(w, err)
+			return
+		}
+		b, err := runs.GetRun(ctx, idB)
+		if err != nil {
+			runError(w, err)
+			return
+		}
+
+		rows := make([]row, max(len(a.States), len(b.States)))
+		for i := range rows {
+			rows[i].Step = i
+			if i < len(a.States) {
+				rows[i].A = &a.States[i]
+			}
+			if i < len(b.States) {
+				rows[i].B = &b.States[i]
+			}
+		}
+
+		w.Header().Add("Content-Type", "text/html")
+		if err := t.Execute(w, tdata{
+			A:    a,
+			B:    b,
+			Rows: rows,
+		}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func handleRunExport(runs *runstorage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid run id", http.StatusBadRequest)
+			return
+		}
+
+		run, err := runs.GetRun(r.Context(), id)
+		if err != nil {
+			runError(w, err)
+			return
+		}
+
+		format := core.ExportFormat(r.URL.Query().Get("format"))
+		if format == "" {
+			format = core.ExportMarkdown
+		}
+		text, err := run.Export(format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(text))
+	}
+}
+
+func runError(w http.ResponseWriter, err error) {
+	if errors.Is(err, runstorage.ErrRunNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
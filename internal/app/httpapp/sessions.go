@@ -0,0 +1,157 @@
+package httpapp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"de/internal/storage/sqlstorage"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	sessionCookie = "de_session"
+	// sessionIDLen is the length of a session id, in hex characters.
+	sessionIDLen = 32
+)
+
+type (
+	storeKey   struct{}
+	sessionKey struct{}
+)
+
+// sandboxNeed is what a route needs of the sandbox of the session.
+type sandboxNeed int
+
+const (
+	// sandboxIfAny uses the sandbox the session has, if any, and the
+	// shared store otherwise.
+	sandboxIfAny sandboxNeed = iota
+	// sandboxTables creates the sandbox if the session has none.
+	sandboxTables
+	// sandboxEmployees also waits for the employees to be copied into it.
+	sandboxEmployees
+)
+
+// sessions issues the ids of the browser sessions and resolves their
+// sandboxes. The ids are signed with a key drawn when the server starts, as
+// they name the sandbox schemas only the ones it issued are accepted.
+type sessions struct {
+	key       []byte
+	sandboxes *sqlstorage.Sandboxes
+}
+
+func newSessions(sandboxes *sqlstorage.Sandboxes) (*sessions, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &sessions{key: key, sandboxes: sandboxes}, nil
+}
+
+// with resolves the store of the requests from their session, starting a new
+// session when a request has none and the route needs a sandbox. The sandbox
+// is held for the whole request, so a websocket keeps it alive while
+// connected. Without sessions the requests use the shared store.
+func (s *sessions) with(need sandboxNeed) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if s == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := s.id(r)
+			if need == sandboxIfAny {
+				if store, release, ok := s.sandboxes.Lookup(session); ok {
+					defer release()
+					r = r.WithContext(context.WithValue(r.Context(), storeKey{}, store))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if session == "" {
+				var err error
+				session, err = s.issue(w)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), sessionKey{}, session))
+			store, release, err := s.sandboxes.Acquire(r.Context(), session, need == sandboxEmployees)
+			if errors.Is(err, sqlstorage.ErrTooManySandboxes) {
+				http.Error(w, "too many visitors have a database of their own, try again later", http.StatusServiceUnavailable)
+				return
+			}
+			if err != nil {
+				log.Printf("acquire sandbox: %v", err)
+				http.Error(w, "failed to prepare your database", http.StatusServiceUnavailable)
+				return
+			}
+			defer release()
+
+			ctx := context.WithValue(r.Context(), storeKey{}, store)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requestStore returns the store of the request's sandbox, or the shared
+// store when sandboxes are disabled.
+func requestStore(r *http.Request, shared *sqlstorage.Store) *sqlstorage.Store {
+	if store, ok := r.Context().Value(storeKey{}).(*sqlstorage.Store); ok {
+		return store
+	}
+	return shared
+}
+
+// requestSession returns the session of the request, empty on the routes
+// without a sandbox.
+func requestSession(r *http.Request) string {
+	session, _ := r.Context().Value(sessionKey{}).(string)
+	return session
+}
+
+// id returns the session of the request, empty when its cookie is missing or
+// was not signed by s.
+func (s *sessions) id(r *http.Request) string {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return ""
+	}
+	id, sig, ok := strings.Cut(c.Value, ".")
+	if !ok || len(id) != sessionIDLen || !hmac.Equal([]byte(sig), []byte(s.sign(id))) {
+		return ""
+	}
+	return id
+}
+
+// issue draws a new session id and sets its cookie.
+func (s *sessions) issue(w http.ResponseWriter) (string, error) {
+	b := make([]byte, sessionIDLen/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id + "." + s.sign(id),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id, nil
+}
+
+func (s *sessions) sign(id string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,135 @@
+package httpapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var errTooManySimulations = errors.New("too many simulations are running, try again later")
+
+// simRegistry tracks the simulations running on every connection, bounding
+// how many run at once overall and for a single client. Each holds open
+// transactions and a scratch table, so they are cancelled when the server
+// shuts down.
+type simRegistry struct {
+	maxTotal     int
+	maxPerClient int
+
+	mu     sync.Mutex
+	nextID int64
+	active map[int64]*activeSim
+}
+
+type activeSim struct {
+	ID       int64     `json:"id"`
+	Scenario string    `json:"scenario"`
+	Started  time.Time `json:"started"`
+
+	// client is not listed, it is the session or the address of the client
+	// and the list is open to anyone.
+	client string
+	cancel context.CancelFunc
+}
+
+func newSimRegistry(maxTotal, maxPerClient int) *simRegistry {
+	return &simRegistry{
+		maxTotal:     maxTotal,
+		maxPerClient: maxPerClient,
+		active:       map[int64]*activeSim{},
+	}
+}
+
+// register records a simulation of the client, the returned context is
+// cancelled by cancelAll and release must be called once the simulation
+// ends.
+func (reg *simRegistry) register(
+	ctx context.Context,
+	client, scenario string,
+) (simCtx context.Context, release func(), err error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if reg.maxTotal > 0 && len(reg.active) >= reg.maxTotal {
+		return nil, nil, errTooManySimulations
+	}
+	if reg.maxPerClient > 0 {
+		n := 0
+		for _, sim := range reg.active {
+			if sim.client == client {
+				n++
+			}
+		}
+		if n >= reg.maxPerClient {
+			return nil, nil, errTooManySimulations
+		}
+	}
+
+	simCtx, cancel := context.WithCancel(ctx)
+	reg.nextID++
+	sim := &activeSim{
+		ID:       reg.nextID,
+		Scenario: scenario,
+		Started:  time.Now(),
+		client:   client,
+		cancel:   cancel,
+	}
+	reg.active[sim.ID] = sim
+
+	release = func() {
+		cancel()
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+		delete(reg.active, sim.ID)
+	}
+	return simCtx, release, nil
+}
+
+func (reg *simRegistry) list() []activeSim {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	sims := make([]activeSim, 0, len(reg.active))
+	for _, sim := range reg.active {
+		sims = append(sims, *sim)
+	}
+	sort.Slice(sims, func(i, j int) bool { return sims[i].ID < sims[j].ID })
+	return sims
+}
+
+// cancelAll cancels every running simulation, their sessions stop them.
+func (reg *simRegistry) cancelAll() {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for _, sim := range reg.active {
+		sim.cancel()
+	}
+}
+
+// clientID tells apart the clients of the simulations, by their session when
+// they have one and by their address otherwise.
+func clientID(r *http.Request) string {
+	if session := requestSession(r); session != "" {
+		return session
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func handleSimulations(sims *simRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(sims.list()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
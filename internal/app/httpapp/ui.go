@@ -16,6 +16,7 @@ func handleIndexPage(store *sqlstorage.Store) http.HandlerFunc {
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
+		store := requestStore(r, store)
 		t, err := template.ParseFiles(
 			"templates/base.tmpl.html",
 			"templates/transfer.tmpl.html",
@@ -61,12 +62,18 @@ func handleIsolationPage(store *sqlstorage.Store) http.HandlerFunc {
 		{Value: "1", Text: "Dirty Read", Checked: true},
 		{Value: "2", Text: "Non Repeatable Read"},
 		{Value: "3", Text: "Phantom Read"},
-		{Value: "4", Text: "Lost Update (Mysql default uses Row Level Locking)", Disabled: true},
+		{Value: "4", Text: "Lost Update (a write from a stale read)"},
+		{Value: "5", Text: "Next-Key Locks (Repeatable Read prevents Phantom Reads)"},
+		{Value: "6", Text: "Cascading Abort (three transactions)"},
+		{Value: "7", Text: "Three-Way Deadlock (three transactions)"},
+		{Value: "8", Text: "Read-Only Anomaly (three transactions)"},
+		{Value: "9", Text: "Optimistic Update (version column prevents the Lost Update)"},
 	}
 
 	type tdata struct {
-		Error string
-		RBtns []radioButton
+		Error      string
+		RBtns      []radioButton
+		Isolations []string
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -81,7 +88,8 @@ func handleIsolationPage(store *sqlstorage.Store) http.HandlerFunc {
 
 		w.Header().Add("Content-Type", "text/html")
 		if err := t.Execute(w, tdata{
-			RBtns: radioButtons[:],
+			RBtns:      radioButtons[:],
+			Isolations: isolationNames,
 		}); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -89,148 +97,107 @@ func handleIsolationPage(store *sqlstorage.Store) http.HandlerFunc {
 	}
 }
 
-func handleRefreshDB(store *sqlstorage.Store) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if err := store.Refresh(r.Context()); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		http.Redirect(w, r, "/", http.StatusFound)
-	}
+// isolationNames are the keys of core.IsolationLevels from the least to the
+// most strict.
+var isolationNames = []string{
+	"read-uncommitted",
+	"read-committed",
+	"repeatable-read",
+	"serializable",
 }
 
-func handleIndexingPage(store *sqlstorage.Store) http.HandlerFunc {
-	type q struct {
-		A string
-		Q string
-	}
-
+func handleConsolePage(store *sqlstorage.Store) http.HandlerFunc {
 	type tdata struct {
-		Error   string
-		Queries []q
-		Count   uint64
+		Error      string
+		Isolations []string
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		t, err := template.ParseFiles(
 			"templates/base.tmpl.html",
-			"templates/indexing.tmpl.html",
+			"templates/console.tmpl.html",
 		)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		ctx := r.Context()
-
-		all, err := store.AnalyzeAllColumnSelect(ctx)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		indexOnly, err := store.AnalyzeIndexedColumnSelect(ctx)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		idOnly, err := store.AnalyzePrimaryKeySelect(ctx)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		unindexedOnly, err := store.AnalyzeUnindexedColumnSelect(ctx)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		allExplicit, err := store.AnalyzeAllExplicitIndexSelect(ctx)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		idName, err := store.AnalyzePrimaryKeyPlusIndexSelect(ctx)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		pagLOID, err := store.AnalyzePaginationLimitOffset(ctx)
-		if err != nil {
+		w.Header().Add("Content-Type", "text/html")
+		if err := t.Execute(w, tdata{
+			Isolations: isolationNames,
+		}); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+	}
+}
 
-		pagCID, err := store.AnalyzePaginationCursor(ctx)
-		if err != nil {
+func handleRefreshDB(store *sqlstorage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := requestStore(r, store)
+		if err := store.Refresh(r.Context()); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
 
-		pagLOIDN, err := store.AnalyzePaginationLOName(ctx)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+func handleIndexingPage(store *sqlstorage.Store, sims *simRegistry) http.HandlerFunc {
+	type tdata struct {
+		Error      string
+		Count      uint64
+		Tables     []string
+		Indexes    []sqlstorage.Index
+		Categories []catalogCategory
+		// Change is the index change the categories compare the plans
+		// before and after of.
+		Change string
+	}
 
-		pagCIDN, err := store.AnalyzePaginationCName(ctx)
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := requestStore(r, store)
+		t, err := template.ParseFiles(
+			"templates/base.tmpl.html",
+			"templates/indexing.tmpl.html",
+			"templates/plan.tmpl.html",
+		)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		pagLOIDNN, err := store.AnalyzePaginationLONameName2(ctx)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+		ctx := r.Context()
+		data := tdata{Tables: sqlstorage.DemoTables()}
 
-		pagCIDNN, err := store.AnalyzePaginationCNameName2(ctx)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		if r.Method == http.MethodPost {
+			changeCtx, release, err := sims.register(ctx, clientID(r), "index change")
+			if err == nil {
+				data.Categories, data.Change, err = changeIndexes(changeCtx, store, r)
+				release()
+			}
+			if err != nil {
+				data.Error = err.Error()
+			}
 		}
-
-		pagLOAll, err := store.AnalyzePaginationLOAll(ctx)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		if data.Change == "" {
+			data.Categories = analyzeCatalog(ctx, store, "")
 		}
 
-		pagCAll, err := store.AnalyzePaginationCAll(ctx)
+		data.Count, err = store.CountEmployees(ctx)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		count, err := store.CountEmployees(ctx)
+		data.Indexes, err = store.ListIndexes(ctx)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Add("Content-Type", "text/html")
-		if err := t.Execute(w, tdata{
-			Count: count,
-			Queries: []q{
-				{Q: "*", A: all},
-				{Q: "name2 (no index)", A: unindexedOnly},
-				{Q: "name (index)", A: indexOnly},
-				{Q: "id (pk)", A: idOnly},
-				{Q: "id + name (f:id)", A: idName},
-				{Q: "id + name + name2 (f:id)", A: allExplicit},
-				{Q: "paginate id (limit,offset)", A: pagLOID},
-				{Q: "paginate id (cursor)", A: pagCID},
-				{Q: "paginate id + name (limit,offset)", A: pagLOIDN},
-				{Q: "paginate id + name (cursor)", A: pagCIDN},
-				{Q: "paginate id + name + name2 (limit,offset)", A: pagLOIDNN},
-				{Q: "paginate id + name + name2 (cursor)", A: pagCIDNN},
-				{Q: "paginate * (limit,offset)", A: pagLOAll},
-				{Q: "paginate * (cursor)", A: pagCAll},
-			},
-		}); err != nil {
+		if err := t.Execute(w, data); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			log.Println(err)
 			return
@@ -0,0 +1,158 @@
+package httpapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsProtocolVersion is bumped whenever the shape of a message changes in a
+// way older clients cannot handle.
+const wsProtocolVersion = 1
+
+const (
+	wsPingInterval = 30 * time.Second
+	wsPongWait     = 2 * wsPingInterval
+	wsWriteWait    = 5 * time.Second
+)
+
+type wsMsgType string
+
+const (
+	// Sent by the client.
+	wsStart   wsMsgType = "start"
+	wsCommand wsMsgType = "command"
+	wsPing    wsMsgType = "ping"
+
+	// Sent by the server.
+	wsState wsMsgType = "state"
+	wsError wsMsgType = "error"
+	wsDone  wsMsgType = "done"
+	wsPong  wsMsgType = "pong"
+
+	// Sent by either side.
+	wsExport wsMsgType = "export"
+)
+
+type wsMessage struct {
+	Version int             `json:"v"`
+	Type    wsMsgType       `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type wsErrorPayload struct {
+	Message string `json:"message"`
+}
+
+// wsInbound is a message read from the client, Err is set instead when the
+// message could not be decoded.
+type wsInbound struct {
+	Msg wsMessage
+	Err error
+}
+
+// readMessages delivers the messages sent by the client until the connection
+// is closed or done is closed. Malformed messages are delivered as errors so
+// they can be reported back to the client. disconnected is called once the
+// client is gone, to cancel whatever is still running for it.
+func readMessages(
+	conn *websocket.Conn,
+	done <-chan struct{},
+	disconnected func(),
+) <-chan wsInbound {
+	in := make(chan wsInbound)
+	go func() {
+		defer close(in)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				disconnected()
+				return
+			}
+			extendReadDeadline(conn)
+
+			msg, err := decodeMessage(data)
+			select {
+			case in <- wsInbound{Msg: msg, Err: err}:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return in
+}
+
+// decodeMessage decodes an envelope, rejecting messages of another protocol
+// version.
+func decodeMessage(data []byte) (wsMessage, error) {
+	var msg wsMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return wsMessage{}, fmt.Errorf("decode message: %v", err)
+	}
+
+	if msg.Version != wsProtocolVersion {
+		return msg, fmt.Errorf(
+			"unsupported protocol version %d, expected %d",
+			msg.Version, wsProtocolVersion,
+		)
+	}
+
+	return msg, nil
+}
+
+func writeMessage(conn *websocket.Conn, t wsMsgType, payload any) error {
+	msg := wsMessage{
+		Version: wsProtocolVersion,
+		Type:    t,
+	}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("marshal %s payload: %v", t, err)
+		}
+		msg.Payload = data
+	}
+
+	if err := conn.SetWriteDeadline(time.Now().Add(wsWriteWait)); err != nil {
+		return err
+	}
+	return conn.WriteJSON(msg)
+}
+
+func writeError(conn *websocket.Conn, err error) error {
+	return writeMessage(conn, wsError, wsErrorPayload{Message: err.Error()})
+}
+
+// extendReadDeadline gives the client another wsPongWait to send a message
+// or answer a ping before the connection is considered dead.
+func extendReadDeadline(conn *websocket.Conn) error {
+	return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+}
+
+// keepAlive pings the client until done is closed, the connection is dropped
+// once the client stops answering. It must be called before the connection is
+// read from.
+func keepAlive(conn *websocket.Conn, done <-chan struct{}) {
+	extendReadDeadline(conn)
+	conn.SetPongHandler(func(string) error {
+		return extendReadDeadline(conn)
+	})
+
+	go func() {
+		ticker := time.NewTicker(wsPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				deadline := time.Now().Add(wsWriteWait)
+				if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,252 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type BankEventType string
+
+const (
+	// BankInvoke is recorded before an operation is sent to the database.
+	BankInvoke BankEventType = "invoke"
+	// BankOK operations completed and took effect.
+	BankOK BankEventType = "ok"
+	// BankFail operations completed without taking effect.
+	BankFail BankEventType = "fail"
+	// BankInfo operations may or may not have taken effect, for example
+	// when committing failed.
+	BankInfo BankEventType = "info"
+)
+
+const (
+	BankTransferF = "transfer"
+	BankReadF     = "read"
+)
+
+type BankTransfer struct {
+	From   uint64 `json:"from"`
+	To     uint64 `json:"to"`
+	Amount uint64 `json:"amount"`
+}
+
+// BankEvent is the invocation or completion of an operation by a client of
+// the bank workload, as seen by the client.
+type BankEvent struct {
+	Process  int              `json:"process"`
+	Type     BankEventType    `json:"type"`
+	F        string           `json:"f"`
+	Transfer *BankTransfer    `json:"transfer,omitempty"`
+	Balances map[uint64]int64 `json:"balances,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	// Time is the time since the workload started.
+	Time time.Duration `json:"time"`
+}
+
+// BankViolation is a read that breaks one of the checked invariants.
+type BankViolation struct {
+	// Event is the position of the completion of the read in the history.
+	Event   int           `json:"event"`
+	Process int           `json:"process"`
+	Time    time.Duration `json:"time"`
+	Detail  string        `json:"detail"`
+}
+
+type BankReport struct {
+	Reads            int `json:"reads"`
+	Transfers        int `json:"transfers"`
+	FailedTransfers  int `json:"failedTransfers"`
+	UnknownTransfers int `json:"unknownTransfers"`
+	// Total is the sum of the initial balances every read must add up to.
+	Total            int64           `json:"total"`
+	TotalViolations  []BankViolation `json:"totalViolations"`
+	NegativeBalances []BankViolation `json:"negativeBalances"`
+	// NonSerializable are reads no set of transfers allowed by the real
+	// time order of the history explains.
+	NonSerializable []BankViolation `json:"nonSerializable"`
+	// Unchecked reads overlapped too many transfers to be checked for
+	// serializability.
+	Unchecked int  `json:"unchecked"`
+	Valid     bool `json:"valid"`
+}
+
+// maxConcurrentTransfers bounds the transfers that may or may not precede a
+// read, every subset of them is tried to explain it.
+const maxConcurrentTransfers = 16
+
+// bankOp pairs the invocation of an operation with its completion, complete
+// is -1 when the operation never completed.
+type bankOp struct {
+	invoke, complete int
+	event            BankEvent
+}
+
+// CheckBank checks a history of the bank workload against the initial
+// balances. Every read must add up to the initial total and have no
+// negative balance, and must be explained by the initial balances with the
+// transfers that completed before it started, plus some of those that
+// overlapped it.
+func CheckBank(initial map[uint64]int64, history []BankEvent) BankReport {
+	var r BankReport
+	for _, b := range initial {
+		r.Total += b
+	}
+
+	var ops []bankOp
+	pending := map[int]int{}
+	for i, e := range history {
+		if e.Type == BankInvoke {
+			pending[e.Process] = len(ops)
+			ops = append(ops, bankOp{invoke: i, complete: -1, event: e})
+			continue
+		}
+		j, ok := pending[e.Process]
+		if !ok {
+			continue
+		}
+		delete(pending, e.Process)
+		ops[j].complete = i
+		ops[j].event.Type = e.Type
+		ops[j].event.Balances = e.Balances
+		ops[j].event.Error = e.Error
+	}
+
+	var transfers []bankOp
+	for _, op := range ops {
+		if op.event.F != BankTransferF {
+			continue
+		}
+		switch op.event.Type {
+		case BankOK:
+			r.Transfers++
+			transfers = append(transfers, op)
+		case BankFail:
+			r.FailedTransfers++
+		default:
+			r.UnknownTransfers++
+			transfers = append(transfers, op)
+		}
+	}
+
+	for _, op := range ops {
+		if op.event.F != BankReadF || op.event.Type != BankOK {
+			continue
+		}
+		r.Reads++
+
+		violation := func(format string, args ...any) BankViolation {
+			return BankViolation{
+				Event:   op.complete,
+				Process: op.event.Process,
+				Time:    history[op.complete].Time,
+				Detail:  fmt.Sprintf(format, args...),
+			}
+		}
+
+		var total int64
+		var negative []string
+		for _, id := range sortedAccounts(op.event.Balances) {
+			b := op.event.Balances[id]
+			total += b
+			if b < 0 {
+				negative = append(negative, fmt.Sprintf("account %d: %d", id, b))
+			}
+		}
+		if total != r.Total {
+			r.TotalViolations = append(r.TotalViolations, violation(
+				"balances add up to %d instead of %d", total, r.Total,
+			))
+		}
+		if len(negative) > 0 {
+			r.NegativeBalances = append(r.NegativeBalances, violation(
+				"negative balances %v", negative,
+			))
+		}
+
+		explained, checked := explainRead(initial, transfers, op)
+		switch {
+		case !checked:
+			r.Unchecked++
+		case !explained:
+			r.NonSerializable = append(r.NonSerializable, violation(
+				"balances %v are not reached by any order of the transfers", op.event.Balances,
+			))
+		}
+	}
+
+	r.Valid = len(r.TotalViolations) == 0 &&
+		len(r.NegativeBalances) == 0 &&
+		len(r.NonSerializable) == 0
+	return r
+}
+
+// explainRead looks for a set of transfers that turns the initial balances
+// into those read. Transfers that completed before the read started must be
+// in it, those that started after the read completed cannot.
+func explainRead(
+	initial map[uint64]int64,
+	transfers []bankOp,
+	read bankOp,
+) (explained, checked bool) {
+	diff := map[uint64]int64{}
+	for id, b := range read.event.Balances {
+		diff[id] = b
+	}
+	for id, b := range initial {
+		if _, ok := diff[id]; !ok {
+			return false, true
+		}
+		diff[id] -= b
+	}
+	if len(diff) != len(initial) {
+		return false, true
+	}
+
+	var maybe []BankTransfer
+	for _, t := range transfers {
+		switch {
+		case t.complete >= 0 && t.complete < read.invoke && t.event.Type == BankOK:
+			tr := t.event.Transfer
+			diff[tr.From] += int64(tr.Amount)
+			diff[tr.To] -= int64(tr.Amount)
+		case t.invoke < read.complete:
+			maybe = append(maybe, *t.event.Transfer)
+		}
+	}
+	if len(maybe) > maxConcurrentTransfers {
+		return false, false
+	}
+
+	var try func(i int) bool
+	try = func(i int) bool {
+		if i == len(maybe) {
+			for _, d := range diff {
+				if d != 0 {
+					return false
+				}
+			}
+			return true
+		}
+		if try(i + 1) {
+			return true
+		}
+		tr := maybe[i]
+		diff[tr.From] += int64(tr.Amount)
+		diff[tr.To] -= int64(tr.Amount)
+		ok := try(i + 1)
+		diff[tr.From] -= int64(tr.Amount)
+		diff[tr.To] += int64(tr.Amount)
+		return ok
+	}
+	return try(0), true
+}
+
+func sortedAccounts(balances map[uint64]int64) []uint64 {
+	ids := make([]uint64, 0, len(balances))
+	for id := range balances {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,237 @@
+package core
+
+import "testing"
+
+func invokeTransfer(p int, from, to, amount uint64) BankEvent {
+	return BankEvent{
+		Process:  p,
+		Type:     BankInvoke,
+		F:        BankTransferF,
+		Transfer: &BankTransfer{From: from, To: to, Amount: amount},
+	}
+}
+
+func completeTransfer(p int, typ BankEventType) BankEvent {
+	return BankEvent{Process: p, Type: typ, F: BankTransferF}
+}
+
+func invokeRead(p int) BankEvent {
+	return BankEvent{Process: p, Type: BankInvoke, F: BankReadF}
+}
+
+func completeRead(p int, balances map[uint64]int64) BankEvent {
+	return BankEvent{Process: p, Type: BankOK, F: BankReadF, Balances: balances}
+}
+
+func TestCheckBank(t *testing.T) {
+	initial := map[uint64]int64{1: 100, 2: 100}
+
+	// concurrent has more transfers overlap the read than are tried, they never
+	// complete.
+	concurrent := []BankEvent{invokeRead(0)}
+	for p := 1; p <= maxConcurrentTransfers+1; p++ {
+		concurrent = append(concurrent, invokeTransfer(p, 1, 2, 1))
+	}
+	concurrent = append(concurrent, completeRead(0, map[uint64]int64{1: 100, 2: 100}))
+
+	tests := []struct {
+		name    string
+		initial map[uint64]int64
+		history []BankEvent
+		// Counts of the report.
+		transfers, failed, unknown int
+		total, negative, nonSerial int
+		unchecked                  int
+		valid                      bool
+	}{
+		{
+			name: "read after a transfer",
+			history: []BankEvent{
+				invokeTransfer(1, 1, 2, 10), completeTransfer(1, BankOK),
+				invokeRead(2), completeRead(2, map[uint64]int64{1: 90, 2: 110}),
+			},
+			transfers: 1,
+			valid:     true,
+		},
+		{
+			name: "read missing a completed transfer",
+			history: []BankEvent{
+				invokeTransfer(1, 1, 2, 10), completeTransfer(1, BankOK),
+				invokeRead(2), completeRead(2, map[uint64]int64{1: 100, 2: 100}),
+			},
+			transfers: 1,
+			nonSerial: 1,
+		},
+		{
+			name: "read before a concurrent transfer",
+			history: []BankEvent{
+				invokeTransfer(1, 1, 2, 10), invokeRead(2),
+				completeRead(2, map[uint64]int64{1: 100, 2: 100}), completeTransfer(1, BankOK),
+			},
+			transfers: 1,
+			valid:     true,
+		},
+		{
+			name: "read after a concurrent transfer",
+			history: []BankEvent{
+				invokeTransfer(1, 1, 2, 10), invokeRead(2),
+				completeRead(2, map[uint64]int64{1: 90, 2: 110}), completeTransfer(1, BankOK),
+			},
+			transfers: 1,
+			valid:     true,
+		},
+		{
+			name: "read of half a transfer",
+			history: []BankEvent{
+				invokeTransfer(1, 1, 2, 10), completeTransfer(1, BankOK),
+				invokeRead(2), completeRead(2, map[uint64]int64{1: 90, 2: 100}),
+			},
+			transfers: 1,
+			total:     1,
+			nonSerial: 1,
+		},
+		{
+			name:    "negative balance",
+			initial: map[uint64]int64{1: 5, 2: 195},
+			history: []BankEvent{
+				invokeTransfer(1, 1, 2, 10), completeTransfer(1, BankOK),
+				invokeRead(2), completeRead(2, map[uint64]int64{1: -5, 2: 205}),
+			},
+			transfers: 1,
+			negative:  1,
+		},
+		{
+			name: "read of a failed transfer",
+			history: []BankEvent{
+				invokeTransfer(1, 1, 2, 10), completeTransfer(1, BankFail),
+				invokeRead(2), completeRead(2, map[uint64]int64{1: 90, 2: 110}),
+			},
+			failed:    1,
+			nonSerial: 1,
+		},
+		{
+			name: "read of a transfer that may have committed",
+			history: []BankEvent{
+				invokeTransfer(1, 1, 2, 10), completeTransfer(1, BankInfo),
+				invokeRead(2), completeRead(2, map[uint64]int64{1: 90, 2: 110}),
+			},
+			unknown: 1,
+			valid:   true,
+		},
+		{
+			name: "read of a missing account",
+			history: []BankEvent{
+				invokeRead(2), completeRead(2, map[uint64]int64{1: 200}),
+			},
+			nonSerial: 1,
+		},
+		{
+			name:      "too many concurrent transfers",
+			history:   concurrent,
+			unknown:   maxConcurrentTransfers + 1,
+			unchecked: 1,
+			valid:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.initial == nil {
+				tt.initial = initial
+			}
+			r := CheckBank(tt.initial, tt.history)
+			got := []int{
+				r.Transfers, r.FailedTransfers, r.UnknownTransfers,
+				len(r.TotalViolations), len(r.NegativeBalances), len(r.NonSerializable),
+				r.Unchecked,
+			}
+			want := []int{
+				tt.transfers, tt.failed, tt.unknown,
+				tt.total, tt.negative, tt.nonSerial,
+				tt.unchecked,
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Errorf("transfers, failed, unknown, total, negative, non-serializable, unchecked = %v, want %v", got, want)
+					break
+				}
+			}
+			if r.Valid != tt.valid {
+				t.Errorf("valid = %v, want %v", r.Valid, tt.valid)
+			}
+		})
+	}
+}
+
+func TestExplainRead(t *testing.T) {
+	initial := map[uint64]int64{1: 100, 2: 100, 3: 100}
+	transfer := func(invoke, complete int, from, to, amount uint64) bankOp {
+		return bankOp{
+			invoke:   invoke,
+			complete: complete,
+			event: BankEvent{
+				Type:     BankOK,
+				F:        BankTransferF,
+				Transfer: &BankTransfer{From: from, To: to, Amount: amount},
+			},
+		}
+	}
+	read := func(invoke, complete int, balances map[uint64]int64) bankOp {
+		return bankOp{
+			invoke:   invoke,
+			complete: complete,
+			event:    BankEvent{Type: BankOK, F: BankReadF, Balances: balances},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		transfers []bankOp
+		read      bankOp
+		explained bool
+	}{
+		{
+			name:      "initial balances",
+			read:      read(0, 1, map[uint64]int64{1: 100, 2: 100, 3: 100}),
+			explained: true,
+		},
+		{
+			name: "some of the concurrent transfers",
+			transfers: []bankOp{
+				transfer(0, 5, 1, 2, 10),
+				transfer(1, 6, 2, 3, 20),
+				transfer(2, 7, 3, 1, 30),
+			},
+			read:      read(3, 4, map[uint64]int64{1: 90, 2: 90, 3: 120}),
+			explained: true,
+		},
+		{
+			name: "transfer started after the read",
+			transfers: []bankOp{
+				transfer(2, 3, 1, 2, 10),
+			},
+			read: read(0, 1, map[uint64]int64{1: 90, 2: 110, 3: 100}),
+		},
+		{
+			name: "transfer completed before the read",
+			transfers: []bankOp{
+				transfer(0, 1, 1, 2, 10),
+			},
+			read: read(2, 3, map[uint64]int64{1: 100, 2: 100, 3: 100}),
+		},
+		{
+			name: "unknown account",
+			read: read(0, 1, map[uint64]int64{1: 100, 2: 100, 4: 100}),
+		},
+	}
+
+	for _, tt := range tests {
+		explained, checked := explainRead(initial, tt.transfers, tt.read)
+		if !checked {
+			t.Errorf("%s: explainRead left the read unchecked", tt.name)
+		}
+		if explained != tt.explained {
+			t.Errorf("%s: explainRead = %v, want %v", tt.name, explained, tt.explained)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"de/internal/storage/sqlstorage"
+	"slices"
+)
+
+// RowDiff is how a transaction's view of a table changed since its previous
+// read, rows are identified by their id.
+type RowDiff[T any] struct {
+	Inserted []uint64 `json:"inserted"`
+	Deleted  []T      `json:"deleted"`
+	// Changed maps the ids of the rows present in both reads to the columns
+	// whose values differ.
+	Changed map[uint64][]string `json:"changed"`
+}
+
+type SaleDiff = RowDiff[sqlstorage.Sale]
+
+func (d *RowDiff[T]) Empty() bool {
+	return len(d.Inserted) == 0 && len(d.Deleted) == 0 && len(d.Changed) == 0
+}
+
+// IDs returns the ids of every row that was inserted, deleted or changed.
+func (d *RowDiff[T]) IDs(id func(T) uint64) []uint64 {
+	ids := slices.Clone(d.Inserted)
+	for _, row := range d.Deleted {
+		ids = append(ids, id(row))
+	}
+	for rowID := range d.Changed {
+		ids = append(ids, rowID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func diffSales(before, after []sqlstorage.Sale) *SaleDiff {
+	prev := map[uint64]sqlstorage.Sale{}
+	for _, s := range before {
+		prev[s.ID] = s
+	}
+
+	d := &SaleDiff{Changed: map[uint64][]string{}}
+	for _, s := range after {
+		old, ok := prev[s.ID]
+		delete(prev, s.ID)
+		if !ok {
+			d.Inserted = append(d.Inserted, s.ID)
+			continue
+		}
+
+		var cols []string
+		if old.Qty != s.Qty {
+			cols = append(cols, "qty")
+		}
+		if old.Price != s.Price {
+			cols = append(cols, "price")
+		}
+		if old.Version != s.Version {
+			cols = append(cols, "version")
+		}
+		if len(cols) > 0 {
+			d.Changed[s.ID] = cols
+		}
+	}
+
+	for _, s := range before {
+		if _, ok := prev[s.ID]; ok {
+			d.Deleted = append(d.Deleted, s)
+		}
+	}
+
+	return d
+}
+
+func saleID(s sqlstorage.Sale) uint64 {
+	return s.ID
+}
@@ -0,0 +1,282 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"de/internal/storage/sqlstorage"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxScriptOps bounds the length of the scripts explored, the number of
+// interleavings grows combinatorially with it.
+const maxScriptOps = 8
+
+// exploreLimit is the number of rows listed after each statement and read
+// back once a schedule has run.
+const exploreLimit = 10
+
+type ScheduleClass string
+
+const (
+	// ScheduleSerializable schedules end the same as one of the serial
+	// orders: every transaction read the same rows and left the same table.
+	ScheduleSerializable ScheduleClass = "serializable"
+	// ScheduleAnomaly schedules match no serial order.
+	ScheduleAnomaly ScheduleClass = "anomaly"
+	// ScheduleAborted schedules had a statement fail, usually the database
+	// aborting a transaction rather than allowing an anomaly.
+	ScheduleAborted ScheduleClass = "aborted"
+)
+
+// ScheduleOutcome is the result of running a single interleaving of the
+// explored transactions.
+type ScheduleOutcome struct {
+	// Order is the transaction running each statement of the schedule.
+	Order  []int
+	States []SaleSimulation
+	// Final are the rows of the table once both transactions ended.
+	Final []sqlstorage.Sale
+	Class ScheduleClass
+	// Matches names the serial order the schedule is equivalent to.
+	Matches string
+}
+
+func (o ScheduleOutcome) Schedule() string {
+	order := make([]string, len(o.Order))
+	for i, tx := range o.Order {
+		order[i] = fmt.Sprint(tx)
+	}
+	return strings.Join(order, " ")
+}
+
+func (o ScheduleOutcome) FinalResult() string {
+	return formatSales(o.Final)
+}
+
+// fingerprint identifies the outcome by what each transaction read and the
+// table left behind, schedules with the same fingerprint are equivalent.
+func (o ScheduleOutcome) fingerprint() string {
+	var b strings.Builder
+	for tx := 1; tx <= 2; tx++ {
+		fmt.Fprintf(&b, "tx%d:", tx)
+		for _, st := range o.States {
+			if st.TxID == fmt.Sprint(tx) && st.Rows != nil {
+				fmt.Fprintf(&b, " %v", st.Rows)
+			}
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "final: %v", o.Final)
+	return b.String()
+}
+
+func (o ScheduleOutcome) failed() bool {
+	for _, st := range o.States {
+		if st.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+type ExploreReport struct {
+	Isolation string
+	Scripts   [2][]SaleOp
+	// Serial are the outcomes of running tx1 before tx2 and tx2 before tx1.
+	Serial    [2]ScheduleOutcome
+	Schedules []ScheduleOutcome
+	// Total is the number of interleavings, Truncated is set when only the
+	// first of them were run.
+	Total     int
+	Truncated bool
+}
+
+// Count returns how many of the explored schedules are of the class.
+func (r ExploreReport) Count(class ScheduleClass) int {
+	var n int
+	for _, o := range r.Schedules {
+		if o.Class == class {
+			n++
+		}
+	}
+	return n
+}
+
+// ExploreSchedules runs every interleaving of the statements of two
+// transactions, up to limit of them, each against its own seeded sales. The
+// outcome of each is compared against the two serial orders to tell which
+// interleavings the isolation level lets through as anomalies.
+func ExploreSchedules(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	isolation sql.IsolationLevel,
+	tx1, tx2 []SaleOp,
+	limit int,
+) (ExploreReport, error) {
+	for i, ops := range [...][]SaleOp{tx1, tx2} {
+		if err := validateScript(ops); err != nil {
+			return ExploreReport{}, fmt.Errorf("tx%d: %v", i+1, err)
+		}
+	}
+
+	report := ExploreReport{
+		Isolation: isolation.String(),
+		Scripts:   [2][]SaleOp{tx1, tx2},
+	}
+
+	serial := [2][]int{
+		interleave(len(tx1), len(tx2), 0, 0),
+		interleave(0, len(tx2), len(tx1), 0),
+	}
+	for i, order := range serial {
+		o, err := runSchedule(ctx, store, isolation, tx1, tx2, order)
+		if err != nil {
+			return ExploreReport{}, err
+		}
+		if o.failed() {
+			return ExploreReport{}, fmt.Errorf(
+				"serial order %s failed, the scripts must succeed on their own",
+				o.Schedule(),
+			)
+		}
+		report.Serial[i] = o
+	}
+	names := map[string]string{
+		report.Serial[0].fingerprint(): "tx1 then tx2",
+		report.Serial[1].fingerprint(): "tx2 then tx1",
+	}
+	if len(names) == 1 {
+		names[report.Serial[0].fingerprint()] = "either serial order"
+	}
+
+	orders := interleavings(len(tx1), len(tx2))
+	report.Total = len(orders)
+	if limit > 0 && len(orders) > limit {
+		orders = orders[:limit]
+		report.Truncated = true
+	}
+
+	for _, order := range orders {
+		o, err := runSchedule(ctx, store, isolation, tx1, tx2, order)
+		if err != nil {
+			return ExploreReport{}, err
+		}
+
+		switch name, ok := names[o.fingerprint()]; {
+		case o.failed():
+			o.Class = ScheduleAborted
+		case ok:
+			o.Class = ScheduleSerializable
+			o.Matches = name
+		default:
+			o.Class = ScheduleAnomaly
+		}
+		report.Schedules = append(report.Schedules, o)
+	}
+
+	return report, nil
+}
+
+func validateScript(ops []SaleOp) error {
+	if len(ops) == 0 {
+		return errors.New("script is empty")
+	}
+	if len(ops) > maxScriptOps {
+		return fmt.Errorf("script has %d statements, at most %d are explored", len(ops), maxScriptOps)
+	}
+	for i, op := range ops {
+		ends := op.Kind == SaleCommit || op.Kind == SaleRollback
+		if last := i == len(ops)-1; ends != last {
+			return errors.New("script must end with, and only with, commit or rollback")
+		}
+	}
+	return nil
+}
+
+// interleavings returns every order of n statements of tx1 and m of tx2 that
+// keeps the statements of each transaction in order.
+func interleavings(n, m int) [][]int {
+	if n == 0 || m == 0 {
+		return [][]int{interleave(n, 0, 0, m)}
+	}
+
+	var orders [][]int
+	for _, rest := range interleavings(n-1, m) {
+		orders = append(orders, append([]int{1}, rest...))
+	}
+	for _, rest := range interleavings(n, m-1) {
+		orders = append(orders, append([]int{2}, rest...))
+	}
+	return orders
+}
+
+// interleave returns the order running a statements of tx1, then b of tx2,
+// c of tx1 and d of tx2.
+func interleave(a, b, c, d int) []int {
+	var order []int
+	for i, n := range [...]int{a, b, c, d} {
+		for j := 0; j < n; j++ {
+			order = append(order, i%2+1)
+		}
+	}
+	return order
+}
+
+func runSchedule(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	isolation sql.IsolationLevel,
+	tx1, tx2 []SaleOp,
+	order []int,
+) (ScheduleOutcome, error) {
+	scenario := SaleScenario{
+		Name:      "Schedule",
+		Isolation: isolation,
+		Limit:     exploreLimit,
+	}
+	next := [...][]SaleOp{tx1, tx2}
+	for _, tx := range order {
+		scenario.Steps = append(scenario.Steps, SaleStep{Tx: tx, Op: next[tx-1][0]})
+		next[tx-1] = next[tx-1][1:]
+	}
+
+	sim, err := NewSaleSimulator(ctx, store, scenario)
+	if err != nil {
+		return ScheduleOutcome{}, err
+	}
+	defer sim.Close()
+
+	var states []SaleSimulation
+	for !sim.Done() {
+		st, err := sim.Next(ctx)
+		if err != nil {
+			return ScheduleOutcome{}, fmt.Errorf("run schedule %v: %v", order, err)
+		}
+		states = append(states, st...)
+	}
+
+	final, err := sim.Committed(ctx, exploreLimit)
+	if err != nil {
+		return ScheduleOutcome{}, fmt.Errorf("list sales: %v", err)
+	}
+
+	return ScheduleOutcome{
+		Order:  order,
+		States: completedStates(states),
+		Final:  final,
+	}, nil
+}
+
+// completedStates drops the states reporting a step as blocked, the step is
+// reported again once it completes.
+func completedStates(states []SaleSimulation) []SaleSimulation {
+	var done []SaleSimulation
+	for _, st := range states {
+		if !st.Blocked {
+			done = append(done, st)
+		}
+	}
+	return done
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"de/internal/storage/sqlstorage"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type ExportFormat string
+
+const (
+	ExportMermaid  ExportFormat = "mermaid"
+	ExportPlantUML ExportFormat = "plantuml"
+	ExportMarkdown ExportFormat = "markdown"
+)
+
+// Export renders the run in a format that can be pasted into documentation.
+func (r SaleRun) Export(format ExportFormat) (string, error) {
+	switch format {
+	case ExportMermaid:
+		return r.Mermaid(), nil
+	case ExportPlantUML:
+		return r.PlantUML(), nil
+	case ExportMarkdown:
+		return r.Markdown(), nil
+	}
+	return "", fmt.Errorf("unknown export format %q", format)
+}
+
+// Mermaid renders the run as a Mermaid sequence diagram with a participant
+// per transaction talking to the database.
+func (r SaleRun) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("sequenceDiagram\n")
+	fmt.Fprintf(&b, "    title %s\n", r.Title())
+	for _, tx := range r.Transactions() {
+		fmt.Fprintf(&b, "    participant tx%s\n", tx)
+	}
+	b.WriteString("    participant DB\n")
+
+	for _, st := range r.States {
+		if st.Step == 0 {
+			fmt.Fprintf(&b, "    Note over DB: %s\n", mermaidEscape(st.Query))
+			continue
+		}
+
+		tx := "tx" + st.TxID
+		switch {
+		case st.Blocked:
+			fmt.Fprintf(&b, "    %s-)DB: %s\n", tx, mermaidEscape(st.Query))
+			fmt.Fprintf(&b, "    Note over %s: waiting for lock\n", tx)
+		case st.Error != "":
+			fmt.Fprintf(&b, "    %s->>DB: %s\n", tx, mermaidEscape(st.Query))
+			fmt.Fprintf(&b, "    DB--x%s: %s\n", tx, mermaidEscape(st.Error))
+		default:
+			fmt.Fprintf(&b, "    %s->>DB: %s\n", tx, mermaidEscape(st.Query))
+			fmt.Fprintf(&b, "    DB-->>%s: %s\n", tx, st.Result())
+		}
+		if marker := endMarker(st); marker != "" {
+			fmt.Fprintf(&b, "    Note over %s: %s\n", tx, marker)
+		}
+	}
+
+	if r.Verdict != nil {
+		fmt.Fprintf(&b, "    Note over DB: %s\n", mermaidEscape(r.Verdict.Summary))
+	}
+
+	return b.String()
+}
+
+// PlantUML renders the run as a PlantUML sequence diagram.
+func (r SaleRun) PlantUML() string {
+	var b strings.Builder
+	b.WriteString("@startuml\n")
+	fmt.Fprintf(&b, "title %s\n", r.Title())
+	for _, tx := range r.Transactions() {
+		fmt.Fprintf(&b, "participant tx%s\n", tx)
+	}
+	b.WriteString("database DB\n")
+
+	for _, st := range r.States {
+		if st.Step == 0 {
+			fmt.Fprintf(&b, "note over DB: %s\n", st.Query)
+			continue
+		}
+
+		tx := "tx" + st.TxID
+		switch {
+		case st.Blocked:
+			fmt.Fprintf(&b, "%s ->> DB: %s\n", tx, st.Query)
+			fmt.Fprintf(&b, "note right of %s: waiting for lock\n", tx)
+		case st.Error != "":
+			fmt.Fprintf(&b, "%s -> DB: %s\n", tx, st.Query)
+			fmt.Fprintf(&b, "DB -->x %s: %s\n", tx, st.Error)
+		default:
+			fmt.Fprintf(&b, "%s -> DB: %s\n", tx, st.Query)
+			fmt.Fprintf(&b, "DB --> %s: %s\n", tx, st.Result())
+		}
+		if marker := endMarker(st); marker != "" {
+			fmt.Fprintf(&b, "hnote over %s: %s\n", tx, marker)
+		}
+	}
+
+	if r.Verdict != nil {
+		fmt.Fprintf(&b, "note over DB: %s\n", r.Verdict.Summary)
+	}
+
+	b.WriteString("@enduml\n")
+	return b.String()
+}
+
+// Markdown renders the run as a table with a column per transaction.
+func (r SaleRun) Markdown() string {
+	txs := r.Transactions()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s\n\n", r.Title())
+	if len(r.States) > 0 && r.States[0].Step == 0 {
+		fmt.Fprintf(&b, "%s\n\n", r.States[0].Query)
+	}
+
+	b.WriteString("| # |")
+	for _, tx := range txs {
+		fmt.Fprintf(&b, " tx%s |", tx)
+	}
+	b.WriteString(" Result | Duration |\n|---|")
+	for range txs {
+		b.WriteString("---|")
+	}
+	b.WriteString("---|---|\n")
+
+	for _, st := range r.States {
+		if st.Step == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "| %d |", st.Step)
+		for _, tx := range txs {
+			cell := ""
+			if tx == st.TxID {
+				cell = "`" + st.Query + "`"
+				if marker := endMarker(st); marker != "" {
+					cell += " **" + marker + "**"
+				}
+			}
+			fmt.Fprintf(&b, " %s |", cell)
+		}
+
+		fmt.Fprintf(&b, " %s | %s |\n", markdownEscape(st.Result()), st.FormatDuration())
+	}
+
+	if r.Verdict != nil {
+		fmt.Fprintf(&b, "\n**Verdict:** %s\n", r.Verdict.Summary)
+	}
+
+	return b.String()
+}
+
+// Result summarises the outcome of the step that produced the state.
+func (st SaleSimulation) Result() string {
+	switch {
+	case st.Blocked:
+		return "waiting for lock"
+	case st.Error != "":
+		return "error: " + st.Error
+	case endMarker(st) != "":
+		return "ok"
+	}
+
+	return formatSales(st.Rows)
+}
+
+func formatSales(sales []sqlstorage.Sale) string {
+	rows := make([]string, 0, len(sales))
+	for _, s := range sales {
+		rows = append(rows, fmt.Sprintf("(%d, qty %d, price %d, version %d)", s.ID, s.Qty, s.Price, s.Version))
+	}
+	return fmt.Sprintf("%d row(s) %s", len(sales), strings.Join(rows, " "))
+}
+
+// endMarker names how a state ended its transaction, if it did.
+func endMarker(st SaleSimulation) string {
+	switch st.Query {
+	case SaleOp{Kind: SaleCommit}.String():
+		return "committed"
+	case SaleOp{Kind: SaleRollback}.String():
+		return "rolled back"
+	}
+	return ""
+}
+
+func (st SaleSimulation) FormatDuration() string {
+	if st.Blocked {
+		return ""
+	}
+	return st.Duration.Round(time.Microsecond).String()
+}
+
+// mermaidEscape drops the characters Mermaid treats as syntax in messages.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(";", ",", "#", "", "\n", " ").Replace(s)
+}
+
+func markdownEscape(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,24 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// IsolationLevels are the isolation levels that can be chosen for the
+// transactions in a simulation or console, keyed by the names used by the UI.
+var IsolationLevels = map[string]sql.IsolationLevel{
+	"read-uncommitted": sql.LevelReadUncommitted,
+	"read-committed":   sql.LevelReadCommitted,
+	"repeatable-read":  sql.LevelRepeatableRead,
+	"serializable":     sql.LevelSerializable,
+}
+
+func ParseIsolationLevel(name string) (sql.IsolationLevel, error) {
+	level, ok := IsolationLevels[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown isolation level %q", name)
+	}
+	return level, nil
+}
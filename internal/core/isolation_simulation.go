@@ -1,349 +1,251 @@
 package core
 
 import (
-	"context"
 	"database/sql"
 	"de/internal/storage/sqlstorage"
+	"fmt"
 )
 
 type SaleSimulation SimulationState[sqlstorage.Sale]
 
-func SimulateLostUpdates(
-	ctx context.Context,
-	store *sqlstorage.Store,
-) ([]SaleSimulation, error) {
-	tx1, err := store.DB.BeginTx(ctx, &sql.TxOptions{
-		Isolation: sql.LevelReadUncommitted,
-	})
-	if err != nil {
-		return nil, err
-	}
-	defer tx1.Rollback()
-
-	tx2, err := store.DB.BeginTx(ctx, &sql.TxOptions{
-		Isolation: sql.LevelReadUncommitted,
-	})
-	if err != nil {
-		return nil, err
-	}
-	defer tx2.Rollback()
-
-	states := []SaleSimulation{{
-		TxID:  "Explanation",
-		Query: "A transaction re-executes a query returning a set of rows that satisfy a search condition and finds that the set of rows satisfying the condition has changed due to another recently-committed transaction.",
-	}}
-	tx1Sales, err := store.ListSales(ctx, tx1, 10, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "1",
-		Query: "SELECT * FROM sales",
-		Rows:  tx1Sales,
-	})
-
-	if err := store.UpdateSaleQty(ctx, tx1, 1, 5); err != nil {
-		return nil, err
-	}
-
-	tx1Sales, err = store.ListSales(ctx, tx1, 10, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "1",
-		Query: "UPDATE sales SET quantity = 5 WHERE id = 1",
-		Rows:  tx1Sales,
-	})
-
-	tx2Sales, err := store.ListSales(ctx, tx2, 10, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "2",
-		Query: "SELECT * FROM sales",
-		Rows:  tx2Sales,
-	})
-
-	if err := store.UpdateSaleQty(ctx, tx2, 1, 20); err != nil {
-		return nil, err
-	}
-	tx2Sales, err = store.ListSales(ctx, tx2, 10, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "2",
-		Query: "UPDATE sales SET quantity = 20 WHERE id = 1",
-		Rows:  tx2Sales,
-	})
-
-	if err := tx2.Commit(); err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "2",
-		Query: "Commit Transaction",
-	})
+type SaleOpKind uint64
 
-	tx1Sales, err = store.ListSales(ctx, tx1, 10, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "1",
-		Query: "SELECT * FROM sales",
-		Rows:  tx1Sales,
-	})
-	states = append(states, SaleSimulation{
-		TxID:  "1",
-		Query: "Rollback Transaction",
-	})
+const (
+	SaleRead SaleOpKind = iota + 1
+	SaleUpdateQty
+	SaleInsert
+	SaleCommit
+	SaleRollback
+	SaleReadRange
+	SaleUpdateQtyIfVersion
+)
 
-	return states, nil
+// SaleOp is a single statement run by one of the simulated transactions
+// against the sales table.
+type SaleOp struct {
+	Kind  SaleOpKind
+	ID    uint64
+	Qty   uint64
+	Price uint64
+	// From and To bound the ids read by a range read, which locks the rows
+	// and gaps it reads when ForUpdate is set.
+	From      uint64
+	To        uint64
+	ForUpdate bool
+	// Version is the version of the row a conditional update expects.
+	Version uint64
 }
 
-func SimulatePhantomRead(
-	ctx context.Context,
-	store *sqlstorage.Store,
-) ([]SaleSimulation, error) {
-	tx1, err := store.DB.BeginTx(ctx, &sql.TxOptions{
-		Isolation: sql.LevelReadCommitted,
-	})
-	if err != nil {
-		return nil, err
-	}
-	defer tx1.Rollback()
-
-	tx2, err := store.DB.BeginTx(ctx, &sql.TxOptions{
-		Isolation: sql.LevelReadCommitted,
-	})
-	if err != nil {
-		return nil, err
-	}
-	defer tx2.Rollback()
-
-	states := []SaleSimulation{{
-		TxID:  "Explanation",
-		Query: "A transaction re-executes a query returning a set of rows that satisfy a search condition and finds that the set of rows satisfying the condition has changed due to another recently-committed transaction.",
-	}}
-	tx1Sales, err := store.ListSales(ctx, tx1, 10, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "1",
-		Query: "SELECT * FROM sales",
-		Rows:  tx1Sales,
-	})
-
-	tx2Sales, err := store.ListSales(ctx, tx2, 10, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "2",
-		Query: "SELECT * FROM sales",
-		Rows:  tx2Sales,
-	})
-
-	if err := store.InsertSale(ctx, tx2, 1, 10); err != nil {
-		return nil, err
-	}
-	tx2Sales, err = store.ListSales(ctx, tx2, 10, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "2",
-		Query: "INSERT INTO sales(quantity, price) VALUES (10, 1)",
-		Rows:  tx2Sales,
-	})
-
-	if err := tx2.Commit(); err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "2",
-		Query: "Commit Transaction",
-	})
-
-	tx1Sales, err = store.ListSales(ctx, tx1, 10, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "1",
-		Query: "SELECT * FROM sales",
-		Rows:  tx1Sales,
-	})
-	states = append(states, SaleSimulation{
-		TxID:  "1",
-		Query: "Rollback Transaction",
-	})
-
-	return states, nil
+func (op SaleOp) String() string {
+	switch op.Kind {
+	case SaleRead:
+		return "SELECT * FROM sales"
+	case SaleUpdateQty:
+		return fmt.Sprintf("UPDATE sales SET quantity = %d WHERE id = %d", op.Qty, op.ID)
+	case SaleUpdateQtyIfVersion:
+		return fmt.Sprintf(
+			"UPDATE sales SET quantity = %d, version = version + 1 WHERE id = %d AND version = %d",
+			op.Qty, op.ID, op.Version,
+		)
+	case SaleInsert:
+		return fmt.Sprintf("INSERT INTO sales(quantity, price) VALUES (%d, %d)", op.Qty, op.Price)
+	case SaleReadRange:
+		query := fmt.Sprintf("SELECT * FROM sales WHERE id BETWEEN %d AND %d", op.From, op.To)
+		if op.ForUpdate {
+			query += " FOR UPDATE"
+		}
+		return query
+	case SaleCommit:
+		return "Commit Transaction"
+	case SaleRollback:
+		return "Rollback Transaction"
+	}
+	return "Unknown"
 }
 
-func SimulateNonRepeatableRead(
-	ctx context.Context,
-	store *sqlstorage.Store,
-) ([]SaleSimulation, error) {
-	tx1, err := store.DB.BeginTx(ctx, &sql.TxOptions{
-		Isolation: sql.LevelReadCommitted,
-	})
-	if err != nil {
-		return nil, err
-	}
-	defer tx1.Rollback()
-
-	tx2, err := store.DB.BeginTx(ctx, &sql.TxOptions{
-		Isolation: sql.LevelReadCommitted,
-	})
-	if err != nil {
-		return nil, err
-	}
-	defer tx2.Rollback()
-
-	states := []SaleSimulation{{
-		TxID:  "Explanation",
-		Query: "A transaction re-reads data it has previously read and finds that data has been modified by another transaction (that committed since the initial read).",
-	}}
-	tx1Sales, err := store.ListSales(ctx, tx1, 2, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "1",
-		Query: "SELECT * FROM sales",
-		Rows:  tx1Sales,
-	})
-
-	tx2Sales, err := store.ListSales(ctx, tx2, 2, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "2",
-		Query: "SELECT * FROM sales",
-		Rows:  tx2Sales,
-	})
+// ReadsRows reports whether the state of the op carries the rows seen by the
+// transaction once it has run.
+func (op SaleOp) ReadsRows() bool {
+	return op.Kind != SaleCommit && op.Kind != SaleRollback
+}
 
-	if err := store.UpdateSaleQty(ctx, tx2, 1, 15); err != nil {
-		return nil, err
-	}
-	tx2Sales, err = store.ListSales(ctx, tx2, 2, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "2",
-		Query: "UPDATE sales SET quantity = 15 WHERE id = 1",
-		Rows:  tx2Sales,
-	})
+type SaleStep struct {
+	Tx int
+	Op SaleOp
+}
 
-	if err := tx2.Commit(); err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "2",
-		Query: "Commit Transaction",
-	})
+type SaleScenario struct {
+	Name        string
+	Explanation string
+	Isolation   sql.IsolationLevel
+	// Limit is the number of sales rows each transaction lists after
+	// running a statement.
+	Limit uint64
+	Steps []SaleStep
+	// Anomaly is the observation that shows the anomaly the scenario
+	// demonstrates happened.
+	Anomaly Observation
+}
 
-	tx1Sales, err = store.ListSales(ctx, tx1, 2, 0)
-	if err != nil {
-		return nil, err
+// Transactions returns the number of concurrent transactions the scenario
+// needs, transactions are numbered from 1.
+func (sc SaleScenario) Transactions() int {
+	var n int
+	for _, step := range sc.Steps {
+		n = max(n, step.Tx)
 	}
-	states = append(states, SaleSimulation{
-		TxID:  "1",
-		Query: "SELECT * FROM sales",
-		Rows:  tx1Sales,
-	})
-	states = append(states, SaleSimulation{
-		TxID:  "1",
-		Query: "Rollback Transaction",
-	})
-
-	return states, nil
+	return n
 }
 
-func SimulateDirtyRead(
-	ctx context.Context,
-	store *sqlstorage.Store,
-) ([]SaleSimulation, error) {
-	tx1, err := store.DB.BeginTx(ctx, &sql.TxOptions{
-		Isolation: sql.LevelReadUncommitted,
-	})
-	if err != nil {
-		return nil, err
-	}
-	defer tx1.Rollback()
+var DirtyReadScenario = SaleScenario{
+	Name:        "Dirty Read",
+	Explanation: "A transaction reads data written by a concurrent uncommitted transaction.",
+	Isolation:   sql.LevelReadUncommitted,
+	Limit:       2,
+	Steps: []SaleStep{
+		{Tx: 1, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 2, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 2, Op: SaleOp{Kind: SaleUpdateQty, ID: 1, Qty: 15}},
+		{Tx: 1, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 2, Op: SaleOp{Kind: SaleRollback}},
+		{Tx: 1, Op: SaleOp{Kind: SaleRollback}},
+	},
+	Anomaly: Observation{First: 1, Second: 4},
+}
 
-	tx2, err := store.DB.BeginTx(ctx, &sql.TxOptions{
-		Isolation: sql.LevelReadUncommitted,
-	})
-	if err != nil {
-		return nil, err
-	}
-	defer tx2.Rollback()
+var NonRepeatableReadScenario = SaleScenario{
+	Name:        "Non Repeatable Read",
+	Explanation: "A transaction re-reads data it has previously read and finds that data has been modified by another transaction (that committed since the initial read).",
+	Isolation:   sql.LevelReadCommitted,
+	Limit:       2,
+	Steps: []SaleStep{
+		{Tx: 1, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 2, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 2, Op: SaleOp{Kind: SaleUpdateQty, ID: 1, Qty: 15}},
+		{Tx: 2, Op: SaleOp{Kind: SaleCommit}},
+		{Tx: 1, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 1, Op: SaleOp{Kind: SaleRollback}},
+	},
+	Anomaly: Observation{First: 1, Second: 5},
+}
 
-	states := []SaleSimulation{{
-		TxID:  "Explanation",
-		Query: "A transaction reads data written by a concurrent uncommitted transaction.",
-	}}
-	tx1Sales, err := store.ListSales(ctx, tx1, 2, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "1",
-		Query: "SELECT * FROM sales",
-		Rows:  tx1Sales,
-	})
+var PhantomReadScenario = SaleScenario{
+	Name:        "Phantom Read",
+	Explanation: "A transaction re-executes a query returning a set of rows that satisfy a search condition and finds that the set of rows satisfying the condition has changed due to another recently-committed transaction.",
+	Isolation:   sql.LevelReadCommitted,
+	Limit:       10,
+	Steps: []SaleStep{
+		{Tx: 1, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 2, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 2, Op: SaleOp{Kind: SaleInsert, Price: 1, Qty: 10}},
+		{Tx: 2, Op: SaleOp{Kind: SaleCommit}},
+		{Tx: 1, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 1, Op: SaleOp{Kind: SaleRollback}},
+	},
+	Anomaly: Observation{First: 1, Second: 5},
+}
 
-	tx2Sales, err := store.ListSales(ctx, tx2, 2, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "2",
-		Query: "SELECT * FROM sales",
-		Rows:  tx2Sales,
-	})
+var NextKeyLockScenario = SaleScenario{
+	Name:        "Phantom Read (Next-Key Locks)",
+	Explanation: "At repeatable read a locking range read takes next-key locks, locking the rows it reads and the gaps before and after them. A concurrent insert into a locked gap waits until the lock is released so the range cannot gain phantom rows.",
+	Isolation:   sql.LevelRepeatableRead,
+	Limit:       10,
+	Steps: []SaleStep{
+		{Tx: 1, Op: SaleOp{Kind: SaleReadRange, From: 1, To: 10}},
+		{Tx: 1, Op: SaleOp{Kind: SaleReadRange, From: 1, To: 10, ForUpdate: true}},
+		{Tx: 2, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 2, Op: SaleOp{Kind: SaleInsert, Price: 1, Qty: 10}},
+		{Tx: 1, Op: SaleOp{Kind: SaleReadRange, From: 1, To: 10, ForUpdate: true}},
+		{Tx: 1, Op: SaleOp{Kind: SaleCommit}},
+		{Tx: 2, Op: SaleOp{Kind: SaleCommit}},
+	},
+	Anomaly: Observation{First: 2, Second: 5},
+}
 
-	if err := store.UpdateSaleQty(ctx, tx2, 1, 15); err != nil {
-		return nil, err
-	}
-	tx2Sales, err = store.ListSales(ctx, tx2, 2, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "2",
-		Query: "UPDATE sales SET quantity = 15 WHERE id = 1",
-		Rows:  tx2Sales,
-	})
+var LostUpdateScenario = SaleScenario{
+	Name:        "Lost Update",
+	Explanation: "Two transactions read the same row and both write it from what they read. tx2 writes and commits first, then tx1 overwrites the row from its stale read: the update of tx2 is lost without tx1 ever having seen it. Row locks do not help, tx2 released its own by committing before tx1 writes: only a locking read or a stricter isolation level prevents it.",
+	Isolation:   sql.LevelReadCommitted,
+	Limit:       10,
+	Steps: []SaleStep{
+		{Tx: 1, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 2, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 2, Op: SaleOp{Kind: SaleUpdateQty, ID: 1, Qty: 20}},
+		{Tx: 2, Op: SaleOp{Kind: SaleCommit}},
+		{Tx: 1, Op: SaleOp{Kind: SaleUpdateQty, ID: 1, Qty: 5}},
+		{Tx: 1, Op: SaleOp{Kind: SaleCommit}},
+	},
+	// The write of tx2 is lost once tx1 writes over it from the rows it
+	// read before.
+	Anomaly: Observation{First: 1, Second: 3, Requires: 5},
+}
 
-	tx1Sales, err = store.ListSales(ctx, tx1, 2, 0)
-	if err != nil {
-		return nil, err
-	}
-	states = append(states, SaleSimulation{
-		TxID:  "1",
-		Query: "SELECT * FROM sales",
-		Rows:  tx1Sales,
-	})
+var OptimisticUpdateScenario = SaleScenario{
+	Name:        "Optimistic Update",
+	Explanation: "The lost update again, but each transaction only writes the row if its version is still the one it read, bumping it. tx2 writes first, so the stale write of tx1 matches no row and fails instead of overwriting it: tx1 has to read the row again and retry. No lock is held between the read and the write.",
+	Isolation:   sql.LevelReadCommitted,
+	Limit:       10,
+	Steps: []SaleStep{
+		{Tx: 1, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 2, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 2, Op: SaleOp{Kind: SaleUpdateQtyIfVersion, ID: 1, Qty: 20, Version: 0}},
+		{Tx: 2, Op: SaleOp{Kind: SaleCommit}},
+		{Tx: 1, Op: SaleOp{Kind: SaleUpdateQtyIfVersion, ID: 1, Qty: 5, Version: 0}},
+		{Tx: 1, Op: SaleOp{Kind: SaleRollback}},
+	},
+	Anomaly: Observation{First: 1, Second: 3, Requires: 5, Rejected: true},
+}
 
-	states = append(states, SaleSimulation{
-		TxID:  "2",
-		Query: "Rollback Transaction",
-	})
+var CascadingAbortScenario = SaleScenario{
+	Name:        "Cascading Abort",
+	Explanation: "A transaction writes a row that a second transaction reads and writes another row from, a third transaction reads both. When the first transaction rolls back, every transaction that read its uncommitted data has to abort as well since what it saw never existed.",
+	Isolation:   sql.LevelReadUncommitted,
+	Limit:       3,
+	Steps: []SaleStep{
+		{Tx: 1, Op: SaleOp{Kind: SaleUpdateQty, ID: 1, Qty: 15}},
+		{Tx: 2, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 2, Op: SaleOp{Kind: SaleUpdateQty, ID: 2, Qty: 30}},
+		{Tx: 3, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 1, Op: SaleOp{Kind: SaleRollback}},
+		{Tx: 2, Op: SaleOp{Kind: SaleRollback}},
+		{Tx: 3, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 3, Op: SaleOp{Kind: SaleRollback}},
+	},
+	Anomaly: Observation{First: 4, Second: 7},
+}
 
-	states = append(states, SaleSimulation{
-		TxID:  "1",
-		Query: "Rollback Transaction",
-	})
+var ThreeWayDeadlockScenario = SaleScenario{
+	Name:        "Three-Way Deadlock",
+	Explanation: "Three transactions each lock a row and then wait on the row locked by the next one, closing a cycle none of them can leave. The database detects the cycle and aborts one of the transactions so the others can proceed.",
+	Isolation:   sql.LevelRepeatableRead,
+	Limit:       3,
+	Steps: []SaleStep{
+		{Tx: 1, Op: SaleOp{Kind: SaleUpdateQty, ID: 1, Qty: 11}},
+		{Tx: 2, Op: SaleOp{Kind: SaleUpdateQty, ID: 2, Qty: 22}},
+		{Tx: 3, Op: SaleOp{Kind: SaleUpdateQty, ID: 3, Qty: 33}},
+		{Tx: 1, Op: SaleOp{Kind: SaleUpdateQty, ID: 2, Qty: 12}},
+		{Tx: 2, Op: SaleOp{Kind: SaleUpdateQty, ID: 3, Qty: 23}},
+		{Tx: 3, Op: SaleOp{Kind: SaleUpdateQty, ID: 1, Qty: 31}},
+		{Tx: 3, Op: SaleOp{Kind: SaleRollback}},
+		{Tx: 2, Op: SaleOp{Kind: SaleCommit}},
+		{Tx: 1, Op: SaleOp{Kind: SaleCommit}},
+	},
+	Anomaly: Observation{Abort: true},
+}
 
-	return states, nil
+var ReadOnlyAnomalyScenario = SaleScenario{
+	Name:        "Read-Only Anomaly",
+	Explanation: "tx2 reads both rows and later writes row 1 from what it read, meanwhile tx1 writes row 2 and commits. The read-only tx3 sees the write of tx1 but not that of tx2, yet tx2 missed the write of tx1 so it has to come before it. No serial order matches, even though every pair of the transactions on its own could be serialized.",
+	Isolation:   sql.LevelRepeatableRead,
+	Limit:       2,
+	Steps: []SaleStep{
+		{Tx: 2, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 1, Op: SaleOp{Kind: SaleUpdateQty, ID: 2, Qty: 40}},
+		{Tx: 1, Op: SaleOp{Kind: SaleCommit}},
+		{Tx: 3, Op: SaleOp{Kind: SaleRead}},
+		{Tx: 3, Op: SaleOp{Kind: SaleCommit}},
+		{Tx: 2, Op: SaleOp{Kind: SaleUpdateQty, ID: 1, Qty: 5}},
+		{Tx: 2, Op: SaleOp{Kind: SaleCommit}},
+	},
+	Anomaly: Observation{First: 1, Second: 4, Requires: 6},
 }
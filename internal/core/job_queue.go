@@ -0,0 +1,223 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"de/internal/storage/sqlstorage"
+	"errors"
+	"sync"
+	"time"
+)
+
+type JobQueueConfig struct {
+	Strategies []sqlstorage.ClaimStrategy
+	Jobs       int
+	Workers    int
+	// WorkTime is how long a worker processes a job, holding the
+	// transaction that claimed it open.
+	WorkTime time.Duration
+	// Timeout bounds each strategy's run, the jobs it did not get to are
+	// reported as left.
+	Timeout time.Duration
+}
+
+// JobQueueResult is how a pool of workers claiming jobs with a strategy
+// fared.
+type JobQueueResult struct {
+	Strategy sqlstorage.ClaimStrategy `json:"strategy"`
+	// Done are the distinct jobs marked done, Processed counts every time a
+	// worker processed a job and Duplicates the jobs processed more than
+	// once.
+	Done       int `json:"done"`
+	Left       int `json:"left"`
+	Processed  int `json:"processed"`
+	Duplicates int `json:"duplicates"`
+	// Conflicts are the NOWAIT claims that found the job locked.
+	Conflicts int `json:"conflicts"`
+	// Failures are the claims that failed on another error, the job was then
+	// left for another attempt.
+	Failures int `json:"failures"`
+	// LockWait is the time the workers spent in the claim and complete
+	// statements, waiting for locks for the most part.
+	LockWait   time.Duration `json:"lockWait"`
+	Elapsed    time.Duration `json:"elapsed"`
+	Throughput float64       `json:"throughput"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// RunJobQueue has a pool of workers drain a queue of jobs with each claim
+// strategy, every strategy on its own queue. A strategy the database does not
+// support is reported with an error instead of failing the others.
+func RunJobQueue(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	cfg JobQueueConfig,
+) ([]JobQueueResult, error) {
+	if cfg.Workers < 1 {
+		return nil, errors.New("the job queue needs at least one worker")
+	}
+
+	var results []JobQueueResult
+	for _, strategy := range cfg.Strategies {
+		r, err := runJobQueue(ctx, store, cfg, strategy)
+		if err != nil {
+			if errors.Is(err, sqlstorage.ErrUnsupported) {
+				results = append(results, JobQueueResult{Strategy: strategy, Error: err.Error()})
+				continue
+			}
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func runJobQueue(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	cfg JobQueueConfig,
+	strategy sqlstorage.ClaimStrategy,
+) (JobQueueResult, error) {
+	queue, err := store.CreateScratchJobs(ctx, cfg.Jobs)
+	if err != nil {
+		return JobQueueResult{}, err
+	}
+	defer queue.Drop(context.Background())
+
+	runCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	pool := jobPool{
+		store:     store,
+		queue:     queue,
+		cfg:       cfg,
+		strategy:  strategy,
+		processed: map[uint64]int{},
+		completed: map[uint64]bool{},
+		result:    JobQueueResult{Strategy: strategy},
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 1; w <= cfg.Workers; w++ {
+		worker := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.work(runCtx, worker)
+		}()
+	}
+	wg.Wait()
+
+	r := pool.result
+	if pool.err != nil {
+		return r, pool.err
+	}
+	r.Elapsed = time.Since(start).Round(time.Millisecond)
+	r.Done = len(pool.completed)
+	r.Left = cfg.Jobs - r.Done
+	for _, n := range pool.processed {
+		r.Processed += n
+		if n > 1 {
+			r.Duplicates++
+		}
+	}
+	r.Throughput = float64(r.Done) / r.Elapsed.Seconds()
+	r.LockWait = r.LockWait.Round(time.Millisecond)
+	return r, nil
+}
+
+// jobPool is the shared state of the workers draining a queue.
+type jobPool struct {
+	store    *sqlstorage.Store
+	queue    sqlstorage.JobsTable
+	cfg      JobQueueConfig
+	strategy sqlstorage.ClaimStrategy
+
+	mu        sync.Mutex
+	processed map[uint64]int
+	completed map[uint64]bool
+	result    JobQueueResult
+	// err is an error that stops the run, the strategy being unsupported.
+	err error
+}
+
+func (p *jobPool) work(ctx context.Context, worker int) {
+	for ctx.Err() == nil {
+		done, err := p.claim(ctx, worker)
+		if done || err != nil {
+			return
+		}
+	}
+}
+
+// claim claims a job, processes it and marks it done in a transaction. It
+// reports done once the queue is empty.
+func (p *jobPool) claim(ctx context.Context, worker int) (done bool, err error) {
+	tx, err := p.store.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return false, p.fail(ctx, err)
+	}
+	defer tx.Rollback()
+
+	start := time.Now()
+	id, err := p.queue.Claim(ctx, tx, p.strategy)
+	p.wait(time.Since(start))
+	switch {
+	case errors.Is(err, sqlstorage.ErrNoJobs):
+		return true, nil
+	case errors.Is(err, sqlstorage.ErrLockNotAvailable):
+		p.mu.Lock()
+		p.result.Conflicts++
+		p.mu.Unlock()
+		return false, nil
+	case err != nil:
+		return false, p.fail(ctx, err)
+	}
+
+	select {
+	case <-time.After(p.cfg.WorkTime):
+	case <-ctx.Done():
+		return false, nil
+	}
+	p.mu.Lock()
+	p.processed[id]++
+	p.mu.Unlock()
+
+	start = time.Now()
+	err = p.queue.Complete(ctx, tx, id, worker)
+	if err == nil {
+		err = tx.Commit()
+	}
+	p.wait(time.Since(start))
+	if err != nil {
+		return false, p.fail(ctx, err)
+	}
+
+	p.mu.Lock()
+	p.completed[id] = true
+	p.mu.Unlock()
+	return false, nil
+}
+
+func (p *jobPool) wait(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.result.LockWait += d
+}
+
+// fail counts a failed attempt, stopping the worker when it cannot succeed.
+func (p *jobPool) fail(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if errors.Is(err, sqlstorage.ErrUnsupported) {
+		p.err = err
+		return err
+	}
+	p.result.Failures++
+	return nil
+}
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"context"
+	"de/internal/storage/sqlstorage"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyBuckets is the number of buckets of a latency histogram.
+const latencyBuckets = 20
+
+type QueryBenchConfig struct {
+	Cases []sqlstorage.QueryCase
+	// Runs are the timed runs of each query, after Warmup untimed ones.
+	Runs   int
+	Warmup int
+	// Concurrency is the number of clients running a query at once.
+	Concurrency int
+}
+
+// QueryBenchResult is the latency distribution of a query of the catalog.
+type QueryBenchResult struct {
+	Case     string                   `json:"case"`
+	Label    string                   `json:"label"`
+	Category sqlstorage.QueryCategory `json:"category"`
+	Runs     int                      `json:"runs"`
+	Errors   int                      `json:"errors"`
+	// Rows is how many rows a run returned.
+	Rows int `json:"rows"`
+	// RowsExamined are the rows the database read to answer the query
+	// once, -1 when the database does not tell.
+	RowsExamined float64         `json:"rowsExamined"`
+	Throughput   float64         `json:"throughput"`
+	Min          time.Duration   `json:"min"`
+	Mean         time.Duration   `json:"mean"`
+	P50          time.Duration   `json:"p50"`
+	P90          time.Duration   `json:"p90"`
+	P99          time.Duration   `json:"p99"`
+	Max          time.Duration   `json:"max"`
+	Histogram    []LatencyBucket `json:"histogram"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// LatencyBucket counts the runs that took up to Upper, and longer than the
+// bucket before.
+type LatencyBucket struct {
+	Upper time.Duration `json:"upper"`
+	Count int           `json:"count"`
+}
+
+// BenchmarkQueries runs each query of the catalog cases the configured
+// number of times and measures how long the runs took. A query that fails
+// is reported with its error instead of failing the others.
+func BenchmarkQueries(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	cfg QueryBenchConfig,
+) ([]QueryBenchResult, error) {
+	if cfg.Runs < 1 {
+		return nil, errors.New("the benchmark needs at least one run")
+	}
+	cfg.Concurrency = max(cfg.Concurrency, 1)
+
+	var results []QueryBenchResult
+	for _, c := range cfg.Cases {
+		r, err := benchmarkQuery(ctx, store, cfg, c)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func benchmarkQuery(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	cfg QueryBenchConfig,
+	c sqlstorage.QueryCase,
+) (QueryBenchResult, error) {
+	r := QueryBenchResult{
+		Case:         c.Name,
+		Label:        c.Label,
+		Category:     c.Category,
+		RowsExamined: -1,
+	}
+
+	if _, err := runQueries(ctx, store, c, cfg.Warmup, cfg.Concurrency); err != nil {
+		return r, err
+	}
+
+	start := time.Now()
+	runs, err := runQueries(ctx, store, c, cfg.Runs, cfg.Concurrency)
+	elapsed := time.Since(start)
+	if err != nil {
+		return r, err
+	}
+
+	var latencies []time.Duration
+	var total time.Duration
+	for _, run := range runs {
+		if run.err != nil {
+			r.Errors++
+			continue
+		}
+		latencies = append(latencies, run.latency)
+		total += run.latency
+		r.Rows = run.rows
+	}
+	r.Runs = len(latencies)
+	if r.Runs == 0 {
+		return r, fmt.Errorf("every run failed: %v", runs[0].err)
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	r.Min = latencies[0]
+	r.Max = latencies[len(latencies)-1]
+	r.Mean = total / time.Duration(r.Runs)
+	r.P50 = percentile(latencies, 50)
+	r.P90 = percentile(latencies, 90)
+	r.P99 = percentile(latencies, 99)
+	r.Histogram = histogram(latencies)
+	r.Throughput = float64(r.Runs) / elapsed.Seconds()
+
+	// EXPLAIN ANALYZE runs the query once more, counting what each step
+	// read.
+	if plan, err := store.AnalyzeCase(ctx, c); err == nil {
+		if rows, ok := plan.RowsExamined(); ok {
+			r.RowsExamined = rows
+		}
+	}
+
+	return r, nil
+}
+
+type queryRun struct {
+	latency time.Duration
+	rows    int
+	err     error
+}
+
+// runQueries runs the query of the case n times, by as many clients at once
+// as the concurrency. It fails only when the context is done.
+func runQueries(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	c sqlstorage.QueryCase,
+	n, concurrency int,
+) ([]queryRun, error) {
+	runs := make([]queryRun, n)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(concurrency, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				start := time.Now()
+				rows, err := store.RunCase(ctx, c)
+				runs[i] = queryRun{latency: time.Since(start), rows: rows, err: err}
+			}
+		}()
+	}
+
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	return runs, ctx.Err()
+}
+
+// percentile returns the latency p percent of the sorted latencies are at
+// most, by the nearest rank.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// histogram spreads the sorted latencies into buckets of equal width between
+// the fastest and the slowest.
+func histogram(sorted []time.Duration) []LatencyBucket {
+	lo, hi := sorted[0], sorted[len(sorted)-1]
+	width := max((hi-lo)/latencyBuckets, 1)
+
+	buckets := make([]LatencyBucket, latencyBuckets)
+	for i := range buckets {
+		buckets[i].Upper = lo + width*time.Duration(i+1)
+	}
+	buckets[len(buckets)-1].Upper = max(buckets[len(buckets)-1].Upper, hi)
+	for _, l := range sorted {
+		i := min(int((l-lo)/width), latencyBuckets-1)
+		buckets[i].Count++
+	}
+	return buckets
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 10; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		sorted []time.Duration
+		p      int
+		want   time.Duration
+	}{
+		{sorted, 0, 1 * time.Millisecond},
+		{sorted, 10, 1 * time.Millisecond},
+		{sorted, 11, 2 * time.Millisecond},
+		{sorted, 50, 5 * time.Millisecond},
+		{sorted, 90, 9 * time.Millisecond},
+		{sorted, 99, 10 * time.Millisecond},
+		{sorted, 100, 10 * time.Millisecond},
+		{sorted[:1], 50, 1 * time.Millisecond},
+		{sorted[:1], 99, 1 * time.Millisecond},
+		{sorted[:2], 50, 1 * time.Millisecond},
+		{sorted[:2], 51, 2 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(tt.sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v, %d) = %v, want %v", tt.sorted, tt.p, got, tt.want)
+		}
+	}
+}
+
+// bucketCounts returns the count of every bucket from those of the buckets
+// that are not empty.
+func bucketCounts(counts map[int]int) []int {
+	all := make([]int, latencyBuckets)
+	for i, n := range counts {
+		all[i] = n
+	}
+	return all
+}
+
+func TestHistogram(t *testing.T) {
+	spread := make([]time.Duration, latencyBuckets)
+	for i := range spread {
+		spread[i] = 10*time.Millisecond + time.Duration(i)*time.Millisecond
+	}
+	ones := make([]int, latencyBuckets)
+	for i := range ones {
+		ones[i] = 1
+	}
+
+	tests := []struct {
+		name   string
+		sorted []time.Duration
+		counts []int
+		// last is the upper bound of the last bucket.
+		last time.Duration
+	}{
+		{
+			name:   "a latency per bucket",
+			sorted: spread,
+			counts: ones,
+			last:   29 * time.Millisecond,
+		},
+		{
+			name:   "same latencies",
+			sorted: []time.Duration{5 * time.Millisecond, 5 * time.Millisecond, 5 * time.Millisecond},
+			counts: bucketCounts(map[int]int{0: 3}),
+			last:   5*time.Millisecond + latencyBuckets,
+		},
+		{
+			name:   "slowest alone",
+			sorted: []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond, 21 * time.Millisecond},
+			counts: bucketCounts(map[int]int{0: 3, latencyBuckets - 1: 1}),
+			last:   21 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buckets := histogram(tt.sorted)
+			if len(buckets) != latencyBuckets {
+				t.Fatalf("got %d buckets, want %d", len(buckets), latencyBuckets)
+			}
+			for i, b := range buckets {
+				if b.Count != tt.counts[i] {
+					t.Errorf("bucket %d has %d latencies, want %d", i, b.Count, tt.counts[i])
+				}
+				if i > 0 && b.Upper <= buckets[i-1].Upper {
+					t.Errorf("bucket %d ends at %v, before bucket %d at %v", i, b.Upper, i-1, buckets[i-1].Upper)
+				}
+			}
+			if last := buckets[len(buckets)-1].Upper; last != tt.last {
+				t.Errorf("last bucket ends at %v, want %v", last, tt.last)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"de/internal/core/serializability"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SaleRun is the record of a single run of a SaleScenario.
+type SaleRun struct {
+	// ID is set once the run has been saved to the run history.
+	ID        int64     `json:"id,omitempty"`
+	Scenario  string    `json:"scenario"`
+	Backend   string    `json:"backend"`
+	Isolation string    `json:"isolation"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	Aborted   bool      `json:"aborted"`
+	// States are the states of the run in order, starting with the
+	// explanation.
+	States  []SaleSimulation `json:"states"`
+	Verdict *Verdict         `json:"verdict,omitempty"`
+	// Serializability is set once every step of the run completed.
+	Serializability *serializability.Report `json:"serializability,omitempty"`
+}
+
+func NewSaleRun(backend string, scenario SaleScenario) SaleRun {
+	return SaleRun{
+		Scenario:  scenario.Name,
+		Backend:   backend,
+		Isolation: scenario.Isolation.String(),
+		Started:   time.Now(),
+	}
+}
+
+func (r SaleRun) Title() string {
+	if r.Backend == "" {
+		return fmt.Sprintf("%s (%s)", r.Scenario, r.Isolation)
+	}
+	return fmt.Sprintf("%s (%s on %s)", r.Scenario, r.Isolation, r.Backend)
+}
+
+func (r SaleRun) Duration() time.Duration {
+	return r.Finished.Sub(r.Started)
+}
+
+// Transactions returns the ids of the transactions in the run in order.
+func (r SaleRun) Transactions() []string {
+	var txs []string
+	seen := map[string]bool{}
+	for _, st := range r.States {
+		if st.Step == 0 || seen[st.TxID] {
+			continue
+		}
+		seen[st.TxID] = true
+		txs = append(txs, st.TxID)
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		a, _ := strconv.Atoi(txs[i])
+		b, _ := strconv.Atoi(txs[j])
+		return a < b
+	})
+	return txs
+}
@@ -0,0 +1,365 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"de/internal/core/serializability"
+	"de/internal/storage/sqlstorage"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// blockedAfter is how long a step may run before it is reported as blocked,
+// usually waiting on a lock held by another transaction.
+const blockedAfter = 500 * time.Millisecond
+
+// SaleSimulator runs the steps of a SaleScenario one at a time, keeping the
+// transactions open between steps so that the database can be inspected
+// mid-scenario.
+//
+// Each transaction runs its steps in order on its own goroutine, a step that
+// blocks does not hold up the steps of the other transactions and completes
+// once whatever it is waiting on is released.
+//
+// The steps run against a scratch sales table of the simulation, created
+// with the seed rows and dropped on Close.
+type SaleSimulator struct {
+	store    *sqlstorage.Store
+	table    sqlstorage.SalesTable
+	scenario SaleScenario
+	txs      []*sql.Tx
+	// threads are the server thread ids of the transactions, used to tell
+	// which locks they hold.
+	threads []uint64
+	queues  []chan SaleSimulation
+	results chan SaleSimulation
+
+	next    int
+	emitted int
+	// inflight are the steps that have not completed keyed by step number,
+	// those already reported as blocked are marked so.
+	inflight  map[int]SaleSimulation
+	completed map[int]SaleSimulation
+	// views are the rows each transaction last saw, keyed by transaction.
+	views map[string][]sqlstorage.Sale
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewSaleSimulator(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	scenario SaleScenario,
+) (*SaleSimulator, error) {
+	table, err := store.CreateScratchSales(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &SaleSimulator{
+		store:     store,
+		table:     table,
+		scenario:  scenario,
+		results:   make(chan SaleSimulation),
+		inflight:  map[int]SaleSimulation{},
+		completed: map[int]SaleSimulation{},
+		views:     map[string][]sqlstorage.Sale{},
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+
+	for i := 0; i < scenario.Transactions(); i++ {
+		tx, err := store.DB.BeginTx(ctx, &sql.TxOptions{
+			Isolation: scenario.Isolation,
+		})
+		if err != nil {
+			return nil, errors.Join(
+				fmt.Errorf("begin tx%d: %v", i+1, err),
+				s.Close(),
+			)
+		}
+		s.txs = append(s.txs, tx)
+
+		thread, err := store.ConnectionID(ctx, tx)
+		if err != nil {
+			return nil, errors.Join(err, s.Close())
+		}
+		s.threads = append(s.threads, thread)
+	}
+
+	for _, tx := range s.txs {
+		queue := make(chan SaleSimulation, len(scenario.Steps))
+		s.queues = append(s.queues, queue)
+		go s.work(tx, queue)
+	}
+
+	return s, nil
+}
+
+func (s *SaleSimulator) Explanation() SaleSimulation {
+	return SaleSimulation{
+		TxID:  "Explanation",
+		Query: s.scenario.Explanation,
+	}
+}
+
+// Done reports whether every step has been run to completion.
+func (s *SaleSimulator) Done() bool {
+	return s.next >= len(s.scenario.Steps) && len(s.inflight) == 0
+}
+
+// Next runs the next step of the scenario and returns the resulting states.
+// Besides the state of the step itself this includes the states of blocked
+// steps that completed in the meantime, if the step blocks its state is
+// marked as blocked and it is returned again once it completes.
+func (s *SaleSimulator) Next(ctx context.Context) ([]SaleSimulation, error) {
+	if s.Done() {
+		return nil, errors.New("simulation has no more steps")
+	}
+
+	if s.next < len(s.scenario.Steps) {
+		step := s.scenario.Steps[s.next]
+		s.next += 1
+		st := SaleSimulation{
+			Op:      s.next,
+			TxID:    fmt.Sprint(step.Tx),
+			Query:   step.Op.String(),
+			Started: time.Now(),
+		}
+		s.inflight[st.Op] = st
+		s.queues[step.Tx-1] <- st
+	}
+
+	var states []SaleSimulation
+	timeout := time.NewTimer(blockedAfter)
+	defer timeout.Stop()
+	for len(s.inflight) > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.ctx.Done():
+			return nil, s.ctx.Err()
+		case st := <-s.results:
+			delete(s.inflight, st.Op)
+			st = s.emit(st)
+			if op := s.scenario.Steps[st.Op-1].Op; op.ReadsRows() && st.Error == "" {
+				if prev, ok := s.views[st.TxID]; ok {
+					st.Diff = diffSales(prev, st.Rows)
+				}
+				s.views[st.TxID] = st.Rows
+			}
+			s.completed[st.Op] = st
+			states = append(states, st)
+			continue
+		case <-timeout.C:
+		}
+
+		for op, st := range s.inflight {
+			if st.Blocked {
+				continue
+			}
+			st.Blocked = true
+			s.inflight[op] = st
+			states = append(states, s.emit(st))
+		}
+		break
+	}
+
+	locks := s.inspectLocks(ctx)
+	for i := range states {
+		states[i].Locks = locks
+	}
+
+	return states, nil
+}
+
+// Verdict tells whether the anomaly the scenario demonstrates was observed,
+// it is only meaningful once the simulation is done.
+func (s *SaleSimulator) Verdict() Verdict {
+	return judge(s.scenario.Name, s.scenario.Anomaly, s.completed)
+}
+
+// History returns the reads, writes and transaction ends of the steps that
+// completed, in the order they completed. The rows listed after a write are
+// only shown to follow the simulation and are not part of the history.
+func (s *SaleSimulator) History() serializability.History {
+	states := make([]SaleSimulation, 0, len(s.completed))
+	for _, st := range s.completed {
+		states = append(states, st)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Step < states[j].Step })
+
+	var h serializability.History
+	for _, st := range states {
+		tx, op := s.scenario.Steps[st.Op-1].Tx, s.scenario.Steps[st.Op-1].Op
+		if st.Error != "" {
+			if op.Kind == SaleCommit {
+				h = append(h, serializability.Op{Tx: tx, Kind: serializability.Abort})
+			}
+			continue
+		}
+
+		switch op.Kind {
+		case SaleRead, SaleReadRange:
+			for _, row := range st.Rows {
+				h = append(h, serializability.Op{Tx: tx, Kind: serializability.Read, Item: row.ID, Value: row.Qty})
+			}
+		case SaleUpdateQty, SaleUpdateQtyIfVersion:
+			h = append(h, serializability.Op{Tx: tx, Kind: serializability.Write, Item: op.ID, Value: op.Qty})
+		case SaleInsert:
+			// The id of the inserted row is the largest matching one since
+			// ids are assigned in increasing order.
+			var id uint64
+			for _, row := range st.Rows {
+				if row.Qty == op.Qty && row.Price == op.Price {
+					id = max(id, row.ID)
+				}
+			}
+			if id != 0 {
+				h = append(h, serializability.Op{Tx: tx, Kind: serializability.Write, Item: id, Value: op.Qty})
+			}
+		case SaleCommit:
+			h = append(h, serializability.Op{Tx: tx, Kind: serializability.Commit})
+		case SaleRollback:
+			h = append(h, serializability.Op{Tx: tx, Kind: serializability.Abort})
+		}
+	}
+
+	return h
+}
+
+func (s *SaleSimulator) emit(st SaleSimulation) SaleSimulation {
+	s.emitted += 1
+	st.Step = s.emitted
+	return st
+}
+
+// work runs the steps queued for a transaction in order.
+func (s *SaleSimulator) work(tx *sql.Tx, queue <-chan SaleSimulation) {
+	for st := range queue {
+		step := s.scenario.Steps[st.Op-1]
+		if err := s.run(s.ctx, tx, step.Op, &st); err != nil {
+			st.Error = err.Error()
+		}
+		st.Duration = time.Since(st.Started)
+
+		select {
+		case s.results <- st:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *SaleSimulator) run(
+	ctx context.Context,
+	tx *sql.Tx,
+	op SaleOp,
+	state *SaleSimulation,
+) error {
+	var err error
+	switch op.Kind {
+	case SaleRead:
+	case SaleReadRange:
+		state.Rows, err = s.table.ListBetween(ctx, tx, op.From, op.To, op.ForUpdate)
+		return err
+	case SaleUpdateQty:
+		err = s.table.UpdateQty(ctx, tx, op.ID, op.Qty)
+	case SaleUpdateQtyIfVersion:
+		err = s.table.UpdateQtyIfVersion(ctx, tx, op.ID, op.Qty, op.Version)
+	case SaleInsert:
+		err = s.table.Insert(ctx, tx, op.Price, op.Qty)
+	case SaleCommit:
+		return tx.Commit()
+	case SaleRollback:
+		return tx.Rollback()
+	default:
+		err = fmt.Errorf("unknown sale op %d", op.Kind)
+	}
+	if err != nil {
+		return err
+	}
+
+	state.Rows, err = s.table.List(ctx, tx, s.scenario.Limit, 0)
+	return err
+}
+
+// inspectLocks captures the locks held once a step has run. Failing to read
+// them does not fail the simulation, the error is reported with the state.
+func (s *SaleSimulator) inspectLocks(ctx context.Context) *LockState {
+	snap, err := s.store.InspectLocks(ctx, s.table.Name)
+	if err != nil {
+		return &LockState{Error: err.Error()}
+	}
+
+	owners := map[string]string{}
+	for _, trx := range snap.Transactions {
+		for i, thread := range s.threads {
+			if trx.ThreadID == thread {
+				owners[trx.ID] = fmt.Sprintf("tx%d", i+1)
+			}
+		}
+	}
+
+	return &LockState{
+		LockSnapshot: snap,
+		Owners:       owners,
+	}
+}
+
+// Committed lists the committed rows of the scratch table, outside of the
+// simulated transactions.
+func (s *SaleSimulator) Committed(ctx context.Context, limit uint64) ([]sqlstorage.Sale, error) {
+	return s.table.List(ctx, s.store.DB, limit, 0)
+}
+
+// Close rolls back any transaction the scenario did not end, cancelling any
+// step that is still blocked, and drops the scratch table.
+func (s *SaleSimulator) Close() error {
+	s.cancel()
+	for _, queue := range s.queues {
+		close(queue)
+	}
+	s.queues = nil
+
+	var errs []error
+	for _, tx := range s.txs {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			errs = append(errs, err)
+		}
+	}
+	// The simulation context is cancelled by now.
+	if err := s.table.Drop(context.Background()); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// RunSaleScenario runs all the steps of the scenario returning every state
+// including the explanation.
+func RunSaleScenario(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	scenario SaleScenario,
+) ([]SaleSimulation, error) {
+	sim, err := NewSaleSimulator(ctx, store, scenario)
+	if err != nil {
+		return nil, err
+	}
+	defer sim.Close()
+
+	states := []SaleSimulation{sim.Explanation()}
+	for !sim.Done() {
+		st, err := sim.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, st...)
+	}
+
+	return states, nil
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseSaleScript parses the statements of a transaction written one per
+// line in a short form of the sales ops:
+//
+//	read
+//	read 1..10 [for update]
+//	update <id> <qty> [if version <version>]
+//	insert <price> <qty>
+//	commit
+//	rollback
+//
+// Blank lines and lines starting with # are ignored.
+func ParseSaleScript(script string) ([]SaleOp, error) {
+	var ops []SaleOp
+	sc := bufio.NewScanner(strings.NewReader(script))
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		op, err := parseSaleOp(strings.Fields(strings.ToLower(text)))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %q: %v", line, text, err)
+		}
+		ops = append(ops, op)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return ops, nil
+}
+
+func parseSaleOp(fields []string) (SaleOp, error) {
+	nums := func(n int) ([]uint64, error) {
+		if len(fields) != n+1 {
+			return nil, fmt.Errorf("%s takes %d arguments", fields[0], n)
+		}
+		vals := make([]uint64, n)
+		for i, f := range fields[1:] {
+			v, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", f)
+			}
+			vals[i] = v
+		}
+		return vals, nil
+	}
+
+	switch fields[0] {
+	case "read":
+		if len(fields) == 1 {
+			return SaleOp{Kind: SaleRead}, nil
+		}
+		return parseRangeRead(fields[1:])
+	case "update":
+		if len(fields) == 6 && fields[3] == "if" && fields[4] == "version" {
+			version, err := strconv.ParseUint(fields[5], 10, 64)
+			if err != nil {
+				return SaleOp{}, fmt.Errorf("invalid number %q", fields[5])
+			}
+			fields = fields[:3]
+			v, err := nums(2)
+			if err != nil {
+				return SaleOp{}, err
+			}
+			return SaleOp{Kind: SaleUpdateQtyIfVersion, ID: v[0], Qty: v[1], Version: version}, nil
+		}
+		v, err := nums(2)
+		if err != nil {
+			return SaleOp{}, err
+		}
+		return SaleOp{Kind: SaleUpdateQty, ID: v[0], Qty: v[1]}, nil
+	case "insert":
+		v, err := nums(2)
+		if err != nil {
+			return SaleOp{}, err
+		}
+		return SaleOp{Kind: SaleInsert, Price: v[0], Qty: v[1]}, nil
+	case "commit":
+		if _, err := nums(0); err != nil {
+			return SaleOp{}, err
+		}
+		return SaleOp{Kind: SaleCommit}, nil
+	case "rollback":
+		if _, err := nums(0); err != nil {
+			return SaleOp{}, err
+		}
+		return SaleOp{Kind: SaleRollback}, nil
+	}
+	return SaleOp{}, fmt.Errorf("unknown statement %q", fields[0])
+}
+
+func parseRangeRead(fields []string) (SaleOp, error) {
+	from, to, ok := strings.Cut(fields[0], "..")
+	if !ok {
+		return SaleOp{}, fmt.Errorf("range %q is not of the form from..to", fields[0])
+	}
+
+	op := SaleOp{Kind: SaleReadRange}
+	var err error
+	if op.From, err = strconv.ParseUint(from, 10, 64); err != nil {
+		return SaleOp{}, fmt.Errorf("invalid number %q", from)
+	}
+	if op.To, err = strconv.ParseUint(to, 10, 64); err != nil {
+		return SaleOp{}, fmt.Errorf("invalid number %q", to)
+	}
+
+	switch strings.Join(fields[1:], " ") {
+	case "":
+	case "for update":
+		op.ForUpdate = true
+	default:
+		return SaleOp{}, fmt.Errorf("unexpected %q after range", strings.Join(fields[1:], " "))
+	}
+
+	return op, nil
+}
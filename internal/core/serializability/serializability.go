@@ -0,0 +1,341 @@
+// Package serializability checks histories of transactions for conflict
+// serializability and names the anomalies they show.
+package serializability
+
+import (
+	"fmt"
+	"sort"
+)
+
+type OpKind string
+
+const (
+	Read   OpKind = "r"
+	Write  OpKind = "w"
+	Commit OpKind = "c"
+	Abort  OpKind = "a"
+)
+
+// Op is a single read or write of an item, or the end of a transaction, in
+// the order the database ran them.
+type Op struct {
+	Tx   int    `json:"tx"`
+	Kind OpKind `json:"kind"`
+	Item uint64 `json:"item,omitempty"`
+	// Value is the value read or written, it tells which write a read saw.
+	Value uint64 `json:"value,omitempty"`
+}
+
+func (op Op) String() string {
+	switch op.Kind {
+	case Read, Write:
+		return fmt.Sprintf("%s%d[%d=%d]", op.Kind, op.Tx, op.Item, op.Value)
+	}
+	return fmt.Sprintf("%s%d", op.Kind, op.Tx)
+}
+
+type History []Op
+
+// Dependency is the kind of a conflict between two transactions.
+type Dependency string
+
+const (
+	// WriteDependency: the later transaction overwrote the item.
+	WriteDependency Dependency = "ww"
+	// ReadDependency: the later transaction read what the earlier wrote.
+	ReadDependency Dependency = "wr"
+	// AntiDependency: the later transaction overwrote what the earlier read.
+	AntiDependency Dependency = "rw"
+)
+
+// Edge orders From before To in any equivalent serial order.
+type Edge struct {
+	From int        `json:"from"`
+	To   int        `json:"to"`
+	Kind Dependency `json:"kind"`
+	Item uint64     `json:"item"`
+}
+
+// Anomaly is one of the phenomena defined by Adya that a history exhibits.
+type Anomaly struct {
+	Name   string `json:"name"`
+	Detail string `json:"detail"`
+}
+
+type Report struct {
+	History History `json:"history"`
+	// Committed are the transactions in the graph, those that aborted are
+	// only considered for aborted reads.
+	Committed []int  `json:"committed"`
+	Edges     []Edge `json:"edges"`
+	// Cycle lists the transactions of a cycle in the graph, with the first
+	// repeated at the end.
+	Cycle        []int     `json:"cycle,omitempty"`
+	Anomalies    []Anomaly `json:"anomalies"`
+	Serializable bool      `json:"serializable"`
+}
+
+// version is a write a read is resolved to, tx 0 being the initial version.
+type version struct {
+	tx  int
+	pos int
+}
+
+// Check builds the direct serialization graph of the committed transactions
+// of the history and labels the anomalies it shows: G0 (write cycles), G1a
+// (aborted reads), G1b (intermediate reads), G1c (circular information flow)
+// and G2-item (item anti-dependency cycles).
+//
+// Which write a read saw is told apart by the value read, the latest earlier
+// write of that value by another transaction, or the initial version when
+// none matches. Predicate reads are treated as reads of the rows returned.
+func Check(h History) Report {
+	r := Report{
+		History:   h,
+		Anomalies: []Anomaly{},
+	}
+
+	ended := map[int]OpKind{}
+	endPos := map[int]int{}
+	for i, op := range h {
+		if op.Kind == Commit || op.Kind == Abort {
+			ended[op.Tx] = op.Kind
+			endPos[op.Tx] = i
+		}
+	}
+	committed := func(tx int) bool {
+		return tx == 0 || ended[tx] == Commit
+	}
+	for tx, kind := range ended {
+		if kind == Commit {
+			r.Committed = append(r.Committed, tx)
+		}
+	}
+	sort.Ints(r.Committed)
+
+	// reads resolves every read to the write it saw.
+	reads := map[int]version{}
+	lastWrite := map[[2]uint64]int{}
+	for i, op := range h {
+		switch op.Kind {
+		case Write:
+			lastWrite[[2]uint64{uint64(op.Tx), op.Item}] = i
+		case Read:
+			reads[i] = resolveRead(h, i)
+		}
+	}
+
+	// order is the version order of each item: its committed writers in
+	// commit order, after the initial version.
+	order := map[uint64][]int{}
+	for _, tx := range r.Committed {
+		for item := range writtenItems(h, tx) {
+			order[item] = append(order[item], tx)
+		}
+	}
+	for item, txs := range order {
+		sort.Slice(txs, func(i, j int) bool { return endPos[txs[i]] < endPos[txs[j]] })
+		order[item] = append([]int{0}, txs...)
+	}
+
+	edges := map[Edge]bool{}
+	addEdge := func(e Edge) {
+		if e.From != e.To && e.From != 0 && !edges[e] {
+			edges[e] = true
+			r.Edges = append(r.Edges, e)
+		}
+	}
+	for item, txs := range order {
+		for i := 1; i+1 < len(txs); i++ {
+			addEdge(Edge{From: txs[i], To: txs[i+1], Kind: WriteDependency, Item: item})
+		}
+	}
+
+	for i, op := range h {
+		if op.Kind != Read || !committed(op.Tx) {
+			continue
+		}
+		v := reads[i]
+		if v.tx == op.Tx {
+			continue
+		}
+
+		if !committed(v.tx) {
+			r.Anomalies = append(r.Anomalies, Anomaly{
+				Name: "G1a",
+				Detail: fmt.Sprintf(
+					"tx%d read item %d written by tx%d, which aborted", op.Tx, op.Item, v.tx,
+				),
+			})
+			continue
+		}
+		if v.tx != 0 && lastWrite[[2]uint64{uint64(v.tx), op.Item}] != v.pos {
+			r.Anomalies = append(r.Anomalies, Anomaly{
+				Name: "G1b",
+				Detail: fmt.Sprintf(
+					"tx%d read item %d as %d, an intermediate value written by tx%d",
+					op.Tx, op.Item, op.Value, v.tx,
+				),
+			})
+		}
+
+		addEdge(Edge{From: v.tx, To: op.Tx, Kind: ReadDependency, Item: op.Item})
+		txs := order[op.Item]
+		for j, tx := range txs {
+			if tx == v.tx && j+1 < len(txs) {
+				addEdge(Edge{From: op.Tx, To: txs[j+1], Kind: AntiDependency, Item: op.Item})
+			}
+		}
+	}
+
+	sort.Slice(r.Edges, func(i, j int) bool {
+		a, b := r.Edges[i], r.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Item < b.Item
+	})
+
+	if c := findCycle(r.Edges, WriteDependency); c != nil {
+		r.Cycle = c
+		r.Anomalies = append(r.Anomalies, Anomaly{
+			Name:   "G0",
+			Detail: "write cycle " + formatCycle(c),
+		})
+	}
+	if c := findCycle(r.Edges, WriteDependency, ReadDependency); c != nil {
+		if r.Cycle == nil {
+			r.Cycle = c
+			r.Anomalies = append(r.Anomalies, Anomaly{
+				Name:   "G1c",
+				Detail: "circular information flow " + formatCycle(c),
+			})
+		}
+	}
+	if c := findAntiDependencyCycle(r.Edges); c != nil {
+		if r.Cycle == nil {
+			r.Cycle = c
+		}
+		r.Anomalies = append(r.Anomalies, Anomaly{
+			Name:   "G2-item",
+			Detail: "anti-dependency cycle " + formatCycle(c),
+		})
+	}
+
+	r.Serializable = len(r.Anomalies) == 0
+	return r
+}
+
+// resolveRead finds the write the read at i saw: the transaction's own latest
+// write of the item, otherwise the latest earlier write of the value read by
+// another transaction, otherwise the initial version.
+func resolveRead(h History, i int) version {
+	read := h[i]
+	for j := i - 1; j >= 0; j-- {
+		op := h[j]
+		if op.Kind == Write && op.Tx == read.Tx && op.Item == read.Item {
+			return version{tx: op.Tx, pos: j}
+		}
+	}
+	for j := i - 1; j >= 0; j-- {
+		op := h[j]
+		if op.Kind == Write && op.Item == read.Item && op.Value == read.Value {
+			return version{tx: op.Tx, pos: j}
+		}
+	}
+	return version{tx: 0, pos: -1}
+}
+
+func writtenItems(h History, tx int) map[uint64]bool {
+	items := map[uint64]bool{}
+	for _, op := range h {
+		if op.Tx == tx && op.Kind == Write {
+			items[op.Item] = true
+		}
+	}
+	return items
+}
+
+// findCycle returns a cycle made only of edges of the given kinds.
+func findCycle(edges []Edge, kinds ...Dependency) []int {
+	graph := map[int][]int{}
+	for _, e := range edges {
+		for _, k := range kinds {
+			if e.Kind == k {
+				graph[e.From] = append(graph[e.From], e.To)
+			}
+		}
+	}
+
+	nodes := make([]int, 0, len(graph))
+	for n := range graph {
+		nodes = append(nodes, n)
+	}
+	sort.Ints(nodes)
+
+	for _, n := range nodes {
+		if path := findPath(graph, n, n); path != nil {
+			return path
+		}
+	}
+	return nil
+}
+
+// findAntiDependencyCycle returns a cycle that has at least one
+// anti-dependency edge.
+func findAntiDependencyCycle(edges []Edge) []int {
+	graph := map[int][]int{}
+	for _, e := range edges {
+		graph[e.From] = append(graph[e.From], e.To)
+	}
+
+	for _, e := range edges {
+		if e.Kind != AntiDependency {
+			continue
+		}
+		if path := findPath(graph, e.To, e.From); path != nil {
+			return append([]int{e.From}, path...)
+		}
+	}
+	return nil
+}
+
+// findPath returns the nodes of a path of at least one edge from one node to
+// another, both included.
+func findPath(graph map[int][]int, from, to int) []int {
+	seen := map[int]bool{}
+	var visit func(n int) []int
+	visit = func(n int) []int {
+		for _, next := range graph[n] {
+			if next == to {
+				return []int{n, to}
+			}
+			if seen[next] {
+				continue
+			}
+			seen[next] = true
+			if path := visit(next); path != nil {
+				return append([]int{n}, path...)
+			}
+		}
+		return nil
+	}
+	return visit(from)
+}
+
+func formatCycle(cycle []int) string {
+	var s string
+	for i, tx := range cycle {
+		if i > 0 {
+			s += " → "
+		}
+		s += fmt.Sprintf("tx%d", tx)
+	}
+	return s
+}
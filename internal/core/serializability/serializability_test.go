@@ -0,0 +1,202 @@
+package serializability
+
+import (
+	"slices"
+	"testing"
+)
+
+func r(tx int, item, value uint64) Op { return Op{Tx: tx, Kind: Read, Item: item, Value: value} }
+func w(tx int, item, value uint64) Op { return Op{Tx: tx, Kind: Write, Item: item, Value: value} }
+func c(tx int) Op                     { return Op{Tx: tx, Kind: Commit} }
+func a(tx int) Op                     { return Op{Tx: tx, Kind: Abort} }
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		history   History
+		edges     []Edge
+		cycle     []int
+		anomalies []string
+	}{
+		{
+			name:    "serial",
+			history: History{w(1, 1, 10), c(1), r(2, 1, 10), c(2)},
+			edges:   []Edge{{From: 1, To: 2, Kind: ReadDependency, Item: 1}},
+		},
+		{
+			name:    "own write",
+			history: History{w(1, 1, 5), r(1, 1, 5), c(1)},
+		},
+		{
+			name:    "write of an aborted transaction",
+			history: History{w(1, 1, 5), a(1), r(2, 1, 10), c(2)},
+		},
+		{
+			// The versions of an item are ordered by commit, interleaved
+			// writes then never make a write cycle.
+			name:    "interleaved writes",
+			history: History{w(1, 1, 1), w(2, 1, 2), w(2, 2, 2), w(1, 2, 1), c(1), c(2)},
+			edges: []Edge{
+				{From: 1, To: 2, Kind: WriteDependency, Item: 1},
+				{From: 1, To: 2, Kind: WriteDependency, Item: 2},
+			},
+		},
+		{
+			name:      "aborted read",
+			history:   History{w(1, 1, 5), r(2, 1, 5), a(1), c(2)},
+			anomalies: []string{"G1a"},
+		},
+		{
+			name:      "intermediate read",
+			history:   History{w(1, 1, 5), r(2, 1, 5), w(1, 1, 6), c(1), c(2)},
+			edges:     []Edge{{From: 1, To: 2, Kind: ReadDependency, Item: 1}},
+			anomalies: []string{"G1b"},
+		},
+		{
+			name:    "circular information flow",
+			history: History{w(1, 1, 1), r(2, 1, 1), w(2, 2, 2), r(1, 2, 2), c(1), c(2)},
+			edges: []Edge{
+				{From: 1, To: 2, Kind: ReadDependency, Item: 1},
+				{From: 2, To: 1, Kind: ReadDependency, Item: 2},
+			},
+			cycle:     []int{1, 2, 1},
+			anomalies: []string{"G1c"},
+		},
+		{
+			name: "write skew",
+			history: History{
+				r(1, 1, 10), r(1, 2, 10), r(2, 1, 10), r(2, 2, 10),
+				w(1, 1, 0), w(2, 2, 0), c(1), c(2),
+			},
+			edges: []Edge{
+				{From: 1, To: 2, Kind: AntiDependency, Item: 2},
+				{From: 2, To: 1, Kind: AntiDependency, Item: 1},
+			},
+			cycle:     []int{1, 2, 1},
+			anomalies: []string{"G2-item"},
+		},
+		{
+			name:    "lost update",
+			history: History{r(1, 1, 10), r(2, 1, 10), w(2, 1, 20), c(2), w(1, 1, 5), c(1)},
+			edges: []Edge{
+				{From: 1, To: 2, Kind: AntiDependency, Item: 1},
+				{From: 2, To: 1, Kind: WriteDependency, Item: 1},
+			},
+			cycle:     []int{1, 2, 1},
+			anomalies: []string{"G2-item"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Check(tt.history)
+			if !slices.Equal(got.Edges, tt.edges) {
+				t.Errorf("edges = %v, want %v", got.Edges, tt.edges)
+			}
+			if !slices.Equal(got.Cycle, tt.cycle) {
+				t.Errorf("cycle = %v, want %v", got.Cycle, tt.cycle)
+			}
+			var names []string
+			for _, a := range got.Anomalies {
+				names = append(names, a.Name)
+			}
+			if !slices.Equal(names, tt.anomalies) {
+				t.Errorf("anomalies = %v, want %v", got.Anomalies, tt.anomalies)
+			}
+			if want := len(tt.anomalies) == 0; got.Serializable != want {
+				t.Errorf("serializable = %v, want %v", got.Serializable, want)
+			}
+		})
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		edges []Edge
+		kinds []Dependency
+		want  []int
+	}{
+		{
+			name: "write cycle",
+			edges: []Edge{
+				{From: 1, To: 2, Kind: WriteDependency},
+				{From: 2, To: 3, Kind: WriteDependency},
+				{From: 3, To: 1, Kind: WriteDependency},
+			},
+			kinds: []Dependency{WriteDependency},
+			want:  []int{1, 2, 3, 1},
+		},
+		{
+			name: "edges of other kinds",
+			edges: []Edge{
+				{From: 1, To: 2, Kind: WriteDependency},
+				{From: 2, To: 1, Kind: ReadDependency},
+			},
+			kinds: []Dependency{WriteDependency},
+		},
+		{
+			name: "edges of both kinds",
+			edges: []Edge{
+				{From: 1, To: 2, Kind: WriteDependency},
+				{From: 2, To: 1, Kind: ReadDependency},
+			},
+			kinds: []Dependency{WriteDependency, ReadDependency},
+			want:  []int{1, 2, 1},
+		},
+		{
+			name: "no cycle",
+			edges: []Edge{
+				{From: 1, To: 2, Kind: WriteDependency},
+				{From: 1, To: 3, Kind: WriteDependency},
+				{From: 2, To: 3, Kind: WriteDependency},
+			},
+			kinds: []Dependency{WriteDependency},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := findCycle(tt.edges, tt.kinds...); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: findCycle = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindAntiDependencyCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		edges []Edge
+		want  []int
+	}{
+		{
+			name: "through other kinds",
+			edges: []Edge{
+				{From: 1, To: 2, Kind: AntiDependency},
+				{From: 2, To: 3, Kind: ReadDependency},
+				{From: 3, To: 1, Kind: WriteDependency},
+			},
+			want: []int{1, 2, 3, 1},
+		},
+		{
+			name: "cycle without an anti-dependency",
+			edges: []Edge{
+				{From: 1, To: 2, Kind: ReadDependency},
+				{From: 2, To: 1, Kind: WriteDependency},
+			},
+		},
+		{
+			name: "anti-dependency out of the cycle",
+			edges: []Edge{
+				{From: 1, To: 2, Kind: ReadDependency},
+				{From: 2, To: 1, Kind: WriteDependency},
+				{From: 2, To: 3, Kind: AntiDependency},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := findAntiDependencyCycle(tt.edges); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: findAntiDependencyCycle = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
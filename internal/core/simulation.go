@@ -1,7 +1,36 @@
 package core
 
+import (
+	"de/internal/storage/sqlstorage"
+	"time"
+)
+
 type SimulationState[T any] struct {
+	// Step is the position of the state in the run, Op the number of the
+	// scenario step that produced it. A step that blocks produces two
+	// states, one when it blocks and one when it completes.
+	Step  int    `json:"step"`
+	Op    int    `json:"op"`
 	TxID  string `json:"tx"`
 	Query string `json:"query"`
 	Rows  []T    `json:"rows"`
+	// Diff is how Rows differ from the rows the transaction saw in its
+	// previous state.
+	Diff *RowDiff[T] `json:"diff,omitempty"`
+	// Started is when the step started running and Duration how long it
+	// took, blocked states have no duration.
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Blocked  bool          `json:"blocked,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Locks    *LockState    `json:"locks,omitempty"`
+}
+
+// LockState is the lock information captured after a simulation step.
+type LockState struct {
+	sqlstorage.LockSnapshot
+	// Owners maps the InnoDB transaction ids in the snapshot to the
+	// simulated transaction they belong to.
+	Owners map[string]string `json:"owners"`
+	Error  string            `json:"error,omitempty"`
 }
@@ -0,0 +1,240 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"de/internal/storage/sqlstorage"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// UpdateStrategy is how a client increments the quantity of a sale, reading
+// it and writing it back.
+type UpdateStrategy string
+
+const (
+	// BlindUpdates read the row and overwrite it in a transaction, losing
+	// the increments that happen in between.
+	BlindUpdates UpdateStrategy = "blind"
+	// OptimisticUpdates read the row without locking it and write it only
+	// if its version did not change, retrying otherwise.
+	OptimisticUpdates UpdateStrategy = "optimistic"
+	// PessimisticUpdates lock the row with SELECT ... FOR UPDATE before
+	// reading it, concurrent increments of the row wait for the lock.
+	PessimisticUpdates UpdateStrategy = "pessimistic"
+)
+
+var UpdateStrategies = []UpdateStrategy{BlindUpdates, OptimisticUpdates, PessimisticUpdates}
+
+func ParseUpdateStrategy(name string) (UpdateStrategy, error) {
+	for _, s := range UpdateStrategies {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown update strategy %q", name)
+}
+
+type UpdateBenchConfig struct {
+	Strategies []UpdateStrategy
+	// Rows are the contention levels run for each strategy: the number of
+	// rows the clients increment, the fewer the more they conflict.
+	Rows    []int
+	Clients int
+	// Duration is how long each strategy runs at each level.
+	Duration  time.Duration
+	Isolation sql.IsolationLevel
+	// MaxRetries bounds the attempts of a single optimistic increment.
+	MaxRetries int
+	Seed       int64
+}
+
+// UpdateBenchResult is what a strategy achieved at a contention level.
+type UpdateBenchResult struct {
+	Strategy UpdateStrategy `json:"strategy"`
+	Rows     int            `json:"rows"`
+	// Updates are the increments that committed.
+	Updates int `json:"updates"`
+	// Retries are the optimistic attempts that found the row changed.
+	Retries int `json:"retries"`
+	// Failures are the increments that gave up on an error: a deadlock, a
+	// busy database or too many retries.
+	Failures int `json:"failures"`
+	// Lost are at least this many committed increments missing from the
+	// final quantities.
+	Lost        int           `json:"lost"`
+	Throughput  float64       `json:"throughput"`
+	MeanLatency time.Duration `json:"meanLatency"`
+}
+
+// BenchmarkUpdates has concurrent clients increment random sales rows with
+// each strategy at each contention level, every run on its own scratch table.
+func BenchmarkUpdates(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	cfg UpdateBenchConfig,
+) ([]UpdateBenchResult, error) {
+	if cfg.Clients < 1 {
+		return nil, errors.New("the benchmark needs at least one client")
+	}
+
+	var results []UpdateBenchResult
+	for _, rows := range cfg.Rows {
+		if rows < 1 {
+			return nil, fmt.Errorf("invalid contention level of %d row(s)", rows)
+		}
+		for _, strategy := range cfg.Strategies {
+			r, err := benchmarkUpdates(ctx, store, cfg, strategy, rows)
+			if err != nil {
+				return nil, fmt.Errorf("%s updates of %d row(s): %v", strategy, rows, err)
+			}
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+func benchmarkUpdates(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	cfg UpdateBenchConfig,
+	strategy UpdateStrategy,
+	rows int,
+) (UpdateBenchResult, error) {
+	table, err := store.CreateScratchSales(ctx)
+	if err != nil {
+		return UpdateBenchResult{}, err
+	}
+	defer table.Drop(context.Background())
+
+	seeded, err := table.List(ctx, store.DB, uint64(rows), 0)
+	if err != nil {
+		return UpdateBenchResult{}, err
+	}
+	for i := len(seeded); i < rows; i++ {
+		if err := table.Insert(ctx, store.DB, 1, 10); err != nil {
+			return UpdateBenchResult{}, err
+		}
+	}
+	before, err := totalQty(ctx, store, table, rows)
+	if err != nil {
+		return UpdateBenchResult{}, err
+	}
+
+	r := UpdateBenchResult{Strategy: strategy, Rows: rows}
+	var (
+		mu      sync.Mutex
+		latency time.Duration
+		wg      sync.WaitGroup
+	)
+	runCtx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	start := time.Now()
+	for c := 0; c < cfg.Clients; c++ {
+		rnd := rand.New(rand.NewSource(cfg.Seed + int64(c)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for runCtx.Err() == nil {
+				id := uint64(rnd.Intn(rows)) + 1
+				opStart := time.Now()
+				retries, err := increment(runCtx, store, table, cfg, strategy, id)
+				if err != nil && runCtx.Err() != nil {
+					// Cut short by the end of the run, it may still
+					// have committed.
+					return
+				}
+
+				mu.Lock()
+				r.Retries += retries
+				if err != nil {
+					r.Failures++
+				} else {
+					r.Updates++
+					latency += time.Since(opStart)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	after, err := totalQty(ctx, store, table, rows)
+	if err != nil {
+		return UpdateBenchResult{}, err
+	}
+
+	// Increments cut short may have committed without being counted, so
+	// this is a lower bound.
+	r.Lost = max(int(before+int64(r.Updates)-after), 0)
+	r.Throughput = float64(r.Updates) / elapsed.Seconds()
+	if r.Updates > 0 {
+		r.MeanLatency = (latency / time.Duration(r.Updates)).Round(time.Microsecond)
+	}
+	return r, nil
+}
+
+// increment adds one to the quantity of a sale with the strategy, returning
+// the optimistic attempts that had to be retried.
+func increment(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	table sqlstorage.SalesTable,
+	cfg UpdateBenchConfig,
+	strategy UpdateStrategy,
+	id uint64,
+) (retries int, err error) {
+	switch strategy {
+	case OptimisticUpdates:
+		for attempt := 0; attempt < max(cfg.MaxRetries, 1); attempt++ {
+			sale, err := table.Get(ctx, store.DB, id, false)
+			if err != nil {
+				return retries, err
+			}
+			err = table.UpdateQtyIfVersion(ctx, store.DB, id, sale.Qty+1, sale.Version)
+			if !errors.Is(err, sqlstorage.ErrVersionConflict) {
+				return retries, err
+			}
+			retries++
+		}
+		return retries, fmt.Errorf("increment sale %d: gave up after %d attempts", id, retries)
+	case BlindUpdates, PessimisticUpdates:
+		tx, err := store.DB.BeginTx(ctx, &sql.TxOptions{Isolation: cfg.Isolation})
+		if err != nil {
+			return 0, err
+		}
+		defer tx.Rollback()
+
+		sale, err := table.Get(ctx, tx, id, strategy == PessimisticUpdates)
+		if err != nil {
+			return 0, err
+		}
+		if err := table.UpdateQty(ctx, tx, id, sale.Qty+1); err != nil {
+			return 0, err
+		}
+		return 0, tx.Commit()
+	}
+	return 0, fmt.Errorf("unknown update strategy %q", strategy)
+}
+
+func totalQty(
+	ctx context.Context,
+	store *sqlstorage.Store,
+	table sqlstorage.SalesTable,
+	rows int,
+) (int64, error) {
+	sales, err := table.ListBetween(ctx, store.DB, 1, uint64(rows), false)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, s := range sales {
+		total += int64(s.Qty)
+	}
+	return total, nil
+}
@@ -0,0 +1,132 @@
+package core
+
+import "fmt"
+
+// Observation is what has to be seen for a scenario's anomaly to have
+// happened: the rows returned at scenario step First differ from those
+// returned at step Second.
+type Observation struct {
+	First  int
+	Second int
+	// Requires is a later step that must also succeed for the anomaly to
+	// count, usually a write made from rows that were already stale.
+	Requires int
+	// Rejected tells the Requires step fails by rejecting its stale write
+	// itself, as versioned updates do, rather than by the isolation level.
+	Rejected bool
+	// Abort makes the anomaly the database aborting a transaction instead,
+	// observed when any step fails.
+	Abort bool
+}
+
+type Verdict struct {
+	Anomaly bool   `json:"anomaly"`
+	Summary string `json:"summary"`
+	// First and Second are the positions of the compared states in the run.
+	First  int `json:"first"`
+	Second int `json:"second"`
+	// Changed are the ids of the rows that differ between the two states.
+	Changed []uint64 `json:"changed"`
+}
+
+const (
+	verdictObserved     = "anomaly observed"
+	verdictPrevented    = "prevented by isolation level"
+	verdictRejected     = "stale write rejected"
+	verdictInconclusive = "inconclusive"
+	verdictAborted      = "transaction aborted"
+	verdictCompleted    = "every transaction completed"
+)
+
+// judge compares the states produced by the steps named in the scenario's
+// observation.
+func judge(
+	name string,
+	obs Observation,
+	completed map[int]SaleSimulation,
+) Verdict {
+	if obs.Abort {
+		return judgeAbort(name, completed)
+	}
+
+	first, ok1 := completed[obs.First]
+	second, ok2 := completed[obs.Second]
+	if !ok1 || !ok2 || first.Error != "" || second.Error != "" {
+		return Verdict{
+			Summary: fmt.Sprintf(
+				"%s: %s, step %d or %d did not complete",
+				name, verdictInconclusive, obs.First, obs.Second,
+			),
+		}
+	}
+
+	v := Verdict{
+		First:   first.Step,
+		Second:  second.Step,
+		Changed: diffSales(first.Rows, second.Rows).IDs(saleID),
+	}
+	v.Anomaly = len(v.Changed) > 0
+
+	var seen string
+	if first.TxID == second.TxID {
+		seen = fmt.Sprintf("tx%s saw", second.TxID)
+	} else {
+		seen = fmt.Sprintf("tx%s and tx%s saw", first.TxID, second.TxID)
+	}
+	switch {
+	case !v.Anomaly:
+		v.Summary = fmt.Sprintf(
+			"%s: %s, %s the same rows at steps %d and %d",
+			name, verdictPrevented, seen, obs.First, obs.Second,
+		)
+	case obs.Requires != 0 && !succeeded(completed, obs.Requires):
+		v.Anomaly = false
+		verdict := verdictPrevented
+		if obs.Rejected {
+			verdict = verdictRejected
+		}
+		v.Summary = fmt.Sprintf(
+			"%s: %s, %s %d row(s) differ at steps %d and %d but step %d failed",
+			name, verdict, seen, len(v.Changed), obs.First, obs.Second, obs.Requires,
+		)
+	default:
+		v.Summary = fmt.Sprintf(
+			"%s: %s, %s %d row(s) differ at steps %d and %d",
+			name, verdictObserved, seen, len(v.Changed), obs.First, obs.Second,
+		)
+	}
+
+	return v
+}
+
+// judgeAbort reports the first step that failed, the database having aborted
+// its transaction.
+func judgeAbort(name string, completed map[int]SaleSimulation) Verdict {
+	var failed SaleSimulation
+	for op, st := range completed {
+		if st.Error != "" && (failed.Op == 0 || op < failed.Op) {
+			failed = st
+		}
+	}
+
+	if failed.Op == 0 {
+		return Verdict{
+			Summary: fmt.Sprintf("%s: %s", name, verdictCompleted),
+		}
+	}
+
+	return Verdict{
+		Anomaly: true,
+		Summary: fmt.Sprintf(
+			"%s: %s, tx%s failed at step %d: %s",
+			name, verdictAborted, failed.TxID, failed.Op, failed.Error,
+		),
+		First:  failed.Step,
+		Second: failed.Step,
+	}
+}
+
+func succeeded(completed map[int]SaleSimulation, op int) bool {
+	st, ok := completed[op]
+	return ok && st.Error == ""
+}
@@ -0,0 +1,170 @@
+package runstorage
+
+import (
+	"context"
+	"database/sql"
+	"de/internal/core"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Store keeps the history of simulation runs in a local SQLite database,
+// separate from the demo data the simulations run against.
+type Store struct {
+	DB *sql.DB
+}
+
+func NewStore(ctx context.Context, path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		DB: db,
+	}
+
+	if err := s.init(ctx); err != nil {
+		return nil, errors.Join(err, s.Close(ctx))
+	}
+
+	return s, nil
+}
+
+func (s *Store) Close(ctx context.Context) error {
+	return s.DB.Close()
+}
+
+func (s *Store) init(ctx context.Context) error {
+	// SQLite allows a single writer, serialising access through one
+	// connection avoids busy errors between concurrent simulations.
+	s.DB.SetMaxOpenConns(1)
+
+	if _, err := s.DB.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			scenario TEXT NOT NULL,
+			backend TEXT NOT NULL,
+			isolation TEXT NOT NULL,
+			verdict TEXT NOT NULL,
+			anomaly INTEGER NOT NULL,
+			aborted INTEGER NOT NULL,
+			started_at INTEGER NOT NULL,
+			finished_at INTEGER NOT NULL,
+			run TEXT NOT NULL
+		);
+`); err != nil {
+		return fmt.Errorf("create runs table: %v", err)
+	}
+
+	return nil
+}
+
+// SaveRun stores the run returning the id it was saved under.
+func (s *Store) SaveRun(ctx context.Context, run core.SaleRun) (int64, error) {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return 0, fmt.Errorf("marshal run: %v", err)
+	}
+
+	var verdict string
+	var anomaly bool
+	if run.Verdict != nil {
+		verdict = run.Verdict.Summary
+		anomaly = run.Verdict.Anomaly
+	}
+
+	const query = `
+	INSERT INTO runs(
+		scenario, backend, isolation, verdict, anomaly, aborted,
+		started_at, finished_at, run
+	)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+	`
+	res, err := s.DB.ExecContext(
+		ctx, query,
+		run.Scenario, run.Backend, run.Isolation, verdict, anomaly, run.Aborted,
+		run.Started.UnixNano(), run.Finished.UnixNano(), string(data),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("insert run: %v", err)
+	}
+
+	return res.LastInsertId()
+}
+
+// ListRuns lists the most recent runs first, the states of the runs are not
+// loaded.
+func (s *Store) ListRuns(
+	ctx context.Context,
+	limit, offset uint64,
+) ([]core.SaleRun, error) {
+	const query = `
+	SELECT id, scenario, backend, isolation, verdict, anomaly, aborted,
+		started_at, finished_at
+	FROM runs
+	ORDER BY id DESC
+	LIMIT ? OFFSET ?
+	`
+	if limit == 0 {
+		limit = 50
+	}
+
+	rows, err := s.DB.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []core.SaleRun
+	for rows.Next() {
+		var run core.SaleRun
+		var verdict core.Verdict
+		var started, finished int64
+		if err := rows.Scan(
+			&run.ID, &run.Scenario, &run.Backend, &run.Isolation,
+			&verdict.Summary, &verdict.Anomaly, &run.Aborted,
+			&started, &finished,
+		); err != nil {
+			return nil, err
+		}
+		run.Started = time.Unix(0, started)
+		run.Finished = time.Unix(0, finished)
+		if verdict.Summary != "" {
+			run.Verdict = &verdict
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+var ErrRunNotFound = errors.New("run not found")
+
+func (s *Store) GetRun(ctx context.Context, id int64) (core.SaleRun, error) {
+	const query = "SELECT run FROM runs WHERE id = ?"
+	var data string
+	err := s.DB.QueryRowContext(ctx, query, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return core.SaleRun{}, fmt.Errorf("run %d: %w", id, ErrRunNotFound)
+	}
+	if err != nil {
+		return core.SaleRun{}, fmt.Errorf("get run %d: %v", id, err)
+	}
+
+	var run core.SaleRun
+	if err := json.Unmarshal([]byte(data), &run); err != nil {
+		return core.SaleRun{}, fmt.Errorf("unmarshal run %d: %v", id, err)
+	}
+	run.ID = id
+
+	return run, nil
+}
@@ -0,0 +1,95 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrCommit is returned when committing fails, whether the transaction
+	// took effect is then unknown.
+	ErrCommit = errors.New("commit failed")
+)
+
+// ReadBalances reads the balance of every account in a single statement of
+// a transaction at the isolation level. Balances are signed so that
+// overdrawn accounts can be told apart.
+func (s *Store) ReadBalances(
+	ctx context.Context,
+	isolation sql.IsolationLevel,
+) (map[uint64]int64, error) {
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{Isolation: isolation})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, balance FROM accounts")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := map[uint64]int64{}
+	for rows.Next() {
+		var id uint64
+		var balance int64
+		if err := rows.Scan(&id, &balance); err != nil {
+			return nil, err
+		}
+		balances[id] = balance
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCommit, err)
+	}
+
+	return balances, nil
+}
+
+// TransferAt moves amount between accounts in a transaction at the isolation
+// level, refusing to overdraw the account it is taken from as read by the
+// transaction.
+func (s *Store) TransferAt(
+	ctx context.Context,
+	isolation sql.IsolationLevel,
+	from, to uint64,
+	amount uint64,
+) error {
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{Isolation: isolation})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var balance int64
+	const query = "SELECT balance FROM accounts WHERE id = ? LIMIT 1"
+	if err := tx.QueryRowContext(ctx, query, from).Scan(&balance); err != nil {
+		return err
+	}
+
+	if balance < int64(amount) {
+		return ErrInsufficientFunds
+	}
+
+	if err := s.withdrawAmount(ctx, tx, from, amount); err != nil {
+		return err
+	}
+
+	if err := s.depositAmount(ctx, tx, to, amount); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", ErrCommit, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+type QueryCategory string
+
+const (
+	LookupQueries     QueryCategory = "Lookups"
+	PaginationQueries QueryCategory = "Pagination"
+	PitfallQueries    QueryCategory = "Index pitfalls"
+)
+
+// QueryCase is a query of the analysis page, its plan is meant to be compared
+// with those of the other cases of its category.
+type QueryCase struct {
+	// Name identifies the case, Label is how it is shown.
+	Name     string
+	Label    string
+	Category QueryCategory
+	SQL      string
+	// Variants replace SQL for the dialects that need another syntax.
+	Variants    map[Dialect]string
+	Explanation string
+	// Pair names the case this one is meant to be compared with, the
+	// difference of their plans is pointed out.
+	Pair string
+}
+
+// Query returns the SQL of the case for the dialect.
+func (c QueryCase) Query(d Dialect) string {
+	if q, ok := c.Variants[d]; ok {
+		return q
+	}
+	return c.SQL
+}
+
+// QueryCatalog lists the cases of the analysis page in the order they are
+// shown. A comparison is added as a case here, the page picks it up.
+var QueryCatalog = []QueryCase{
+	{
+		Name:        "lookup-all",
+		Label:       "*",
+		Category:    LookupQueries,
+		SQL:         "SELECT * FROM employees WHERE id = 777",
+		Explanation: "A primary key lookup, the whole row is read from the table.",
+	},
+	{
+		Name:        "lookup-unindexed",
+		Label:       "name2 (no index)",
+		Category:    LookupQueries,
+		SQL:         "SELECT name2 FROM employees WHERE name2 = 777",
+		Explanation: "Nothing indexes name2, every row of the table is scanned.",
+	},
+	{
+		Name:        "lookup-indexed",
+		Label:       "name (index)",
+		Category:    LookupQueries,
+		SQL:         "SELECT name FROM employees WHERE name = 777",
+		Explanation: "The name index covers the query so the table is not read. The column is compared with a number though, which may keep the index from being searched.",
+	},
+	{
+		Name:        "lookup-pk",
+		Label:       "id (pk)",
+		Category:    LookupQueries,
+		SQL:         "SELECT id FROM employees WHERE id = 777",
+		Explanation: "A primary key lookup of the key alone.",
+	},
+	{
+		Name:        "lookup-pk-name",
+		Label:       "id + name (f:id)",
+		Category:    LookupQueries,
+		SQL:         "SELECT id, name FROM employees WHERE id = 777",
+		Explanation: "Filtered on the primary key, the name comes from the row.",
+	},
+	{
+		Name:        "lookup-pk-name-name2",
+		Label:       "id + name + name2 (f:id)",
+		Category:    LookupQueries,
+		SQL:         "SELECT id, name, name2 FROM employees WHERE id = 777",
+		Explanation: "Every column listed explicitly, the same plan as *.",
+	},
+}
+
+// pitfallCases pair a query keeping an index from being used with one doing
+// the same thing that uses it.
+var pitfallCases = []QueryCase{
+	{
+		Name:        "pitfall-numeric-literal",
+		Label:       "name = number",
+		Category:    PitfallQueries,
+		SQL:         "SELECT id, name FROM employees WHERE name = 777",
+		Explanation: "name is a string compared with a number. MySQL converts every name to a number to compare them, which the index cannot help with, and '777', '0777' and '777abc' all match. SQLite converts the number to text instead, the column has text affinity, so the index is used.",
+		Pair:        "pitfall-string-literal",
+	},
+	{
+		Name:        "pitfall-string-literal",
+		Label:       "name = string",
+		Category:    PitfallQueries,
+		SQL:         "SELECT id, name FROM employees WHERE name = '777'",
+		Explanation: "The literal has the type of the column, the index is searched.",
+	},
+	{
+		Name:     "pitfall-collation",
+		Label:    "name = string of another collation",
+		Category: PitfallQueries,
+		SQL:      "SELECT id, name FROM employees WHERE name = '777' COLLATE utf8mb4_bin",
+		Variants: map[Dialect]string{
+			SQLite: "SELECT id, name FROM employees WHERE name = '777' COLLATE NOCASE",
+		},
+		Explanation: "The index is sorted by the collation of the column. Comparing with another collation, forced on the literal here and often coming from a joined column or the connection, orders names differently so the index cannot be searched.",
+		Pair:        "pitfall-string-literal",
+	},
+	{
+		Name:        "pitfall-function",
+		Label:       "function of name",
+		Category:    PitfallQueries,
+		SQL:         "SELECT id, name FROM employees WHERE SUBSTR(name, 1, 2) = '77'",
+		Explanation: "The index holds the names, not what a function makes of them, so every name is read to apply the function.",
+		Pair:        "pitfall-range",
+	},
+	{
+		Name:        "pitfall-range",
+		Label:       "range of name",
+		Category:    PitfallQueries,
+		SQL:         "SELECT id, name FROM employees WHERE name >= '77' AND name < '78'",
+		Explanation: "The same names as a range of the column itself, the index is searched from the first to the last.",
+	},
+	{
+		Name:        "pitfall-leading-wildcard",
+		Label:       "LIKE with a leading wildcard",
+		Category:    PitfallQueries,
+		SQL:         "SELECT id, name FROM employees WHERE name LIKE '%77'",
+		Explanation: "Names ending the same are spread all over the index, every name is read.",
+		Pair:        "pitfall-prefix",
+	},
+	{
+		Name:     "pitfall-prefix",
+		Label:    "LIKE with a prefix",
+		Category: PitfallQueries,
+		SQL:      "SELECT id, name FROM employees WHERE name LIKE '77%'",
+		Variants: map[Dialect]string{
+			// LIKE ignores case on SQLite, it uses the index only on
+			// columns that do too. GLOB is its case sensitive version.
+			SQLite: "SELECT id, name FROM employees WHERE name GLOB '77*'",
+		},
+		Explanation: "Names starting the same are next to each other in the index, it is searched as a range. SQLite uses GLOB, its LIKE ignores case unlike the index.",
+	},
+}
+
+func init() {
+	QueryCatalog = append(QueryCatalog, pitfallCases...)
+
+	// Each selection is paginated both ways, deep into the table.
+	for _, sel := range []struct{ name, label, columns string }{
+		{"id", "id", "id"},
+		{"name", "id + name", "id, name"},
+		{"name-name2", "id + name + name2", "id, name, name2"},
+		{"all", "*", "*"},
+	} {
+		QueryCatalog = append(QueryCatalog,
+			QueryCase{
+				Name:        "page-offset-" + sel.name,
+				Label:       "paginate " + sel.label + " (limit,offset)",
+				Category:    PaginationQueries,
+				SQL:         "SELECT " + sel.columns + " FROM employees ORDER BY id DESC LIMIT 10 OFFSET 876550",
+				Explanation: "The offset rows are read and thrown away before the page, the deeper the page the slower.",
+			},
+			QueryCase{
+				Name:        "page-cursor-" + sel.name,
+				Label:       "paginate " + sel.label + " (cursor)",
+				Category:    PaginationQueries,
+				SQL:         "SELECT " + sel.columns + " FROM employees WHERE id < 121452 ORDER BY id DESC LIMIT 10",
+				Explanation: "The page starts after the last id of the previous one, found through the primary key.",
+			},
+		)
+	}
+}
+
+// Reads tells whether the query of the case names the table, a case that
+// cannot be tokenized is taken to read it.
+func (c QueryCase) Reads(d Dialect, table string) bool {
+	tokens, err := sqlTokens(d, c.Query(d))
+	if err != nil {
+		return true
+	}
+	for _, t := range tokens {
+		if (t.kind == sqlWord || t.kind == sqlQuoted) && strings.EqualFold(t.text, table) {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryCaseNamed returns the case of the catalog with the name.
+func QueryCaseNamed(name string) (QueryCase, bool) {
+	for _, c := range QueryCatalog {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return QueryCase{}, false
+}
+
+// RunCase runs the query of a case reading every row it returns, it returns
+// how many there were.
+func (s *Store) RunCase(ctx context.Context, c QueryCase) (int, error) {
+	rows, err := s.DB.QueryContext(ctx, c.Query(s.Dialect))
+	if err != nil {
+		return 0, fmt.Errorf("run %s: %v", c.Name, err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	values := make([]sql.RawBytes, len(cols))
+	dest := make([]any, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return 0, err
+		}
+		n++
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("run %s: %v", c.Name, err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,299 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Table is the result of a statement whose columns are not known ahead of
+// time, every value is rendered as text.
+type Table struct {
+	Columns  []string   `json:"columns"`
+	Rows     [][]string `json:"rows"`
+	Affected int64      `json:"affected"`
+	// Truncated is set when more rows were returned than were kept.
+	Truncated bool `json:"truncated"`
+}
+
+const nullText = "NULL"
+
+func queryTable(
+	ctx context.Context,
+	conn dbTx,
+	query string,
+	maxRows int,
+	args ...any,
+) (Table, error) {
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return Table{}, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return Table{}, err
+	}
+
+	t := Table{Columns: cols}
+	values := make([]sql.NullString, len(cols))
+	dest := make([]any, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if maxRows > 0 && len(t.Rows) == maxRows {
+			t.Truncated = true
+			break
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return Table{}, err
+		}
+		row := make([]string, len(cols))
+		for i, v := range values {
+			row[i] = nullText
+			if v.Valid {
+				row[i] = v.String
+			}
+		}
+		t.Rows = append(t.Rows, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return Table{}, err
+	}
+
+	return t, nil
+}
+
+// consoleStatements are the statements a console is allowed to run, keyed
+// by their leading keyword.
+var consoleStatements = map[string]bool{
+	"SELECT": true,
+	"INSERT": false,
+	"UPDATE": false,
+	"DELETE": false,
+}
+
+const consoleMaxRows = 100
+
+// consoleTimeout bounds every statement of a console, one waiting on a lock
+// included.
+const consoleTimeout = 30 * time.Second
+
+// consoleConnectTimeout is how long a console waits for a connection of the
+// pool to be free.
+const consoleConnectTimeout = 5 * time.Second
+
+var ErrStatementNotAllowed = errors.New("statement not allowed")
+
+// Console is a transaction pinned to its own connection that ad hoc
+// statements are run in. Once the transaction is committed or rolled back a
+// new one is started at the same isolation level.
+type Console struct {
+	mu        sync.Mutex
+	db        *sql.DB
+	dialect   Dialect
+	conn      *sql.Conn
+	tx        *sql.Tx
+	isolation sql.IsolationLevel
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// OpenConsole opens a console which lasts until it is closed or ctx is done.
+func (s *Store) OpenConsole(ctx context.Context, isolation sql.IsolationLevel) (*Console, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &Console{
+		db:        s.DB,
+		dialect:   s.Dialect,
+		isolation: isolation,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	if err := c.connect(); err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := c.begin(); err != nil {
+		return nil, errors.Join(err, c.Close())
+	}
+
+	return c, nil
+}
+
+// connect pins a connection to the console, MySQL stopping its reads on the
+// server once they run for longer than consoleTimeout.
+func (c *Console) connect() error {
+	connCtx, cancel := context.WithTimeout(c.ctx, consoleConnectTimeout)
+	defer cancel()
+	conn, err := c.db.Conn(connCtx)
+	if err != nil {
+		return fmt.Errorf("console connection: %v", err)
+	}
+	if c.dialect == MySQL {
+		ms := consoleTimeout.Milliseconds()
+		if _, err := conn.ExecContext(c.ctx, "SET SESSION max_execution_time = ?", ms); err != nil {
+			return errors.Join(fmt.Errorf("limit execution time: %v", err), conn.Close())
+		}
+	}
+	c.conn = conn
+	return nil
+}
+
+// disconnect returns the connection to the pool with the settings of
+// connect undone.
+func (c *Console) disconnect() error {
+	if c.dialect == MySQL {
+		c.conn.ExecContext(context.Background(), "SET SESSION max_execution_time = DEFAULT")
+	}
+	return c.conn.Close()
+}
+
+func (c *Console) begin() error {
+	tx, err := c.conn.BeginTx(c.ctx, &sql.TxOptions{Isolation: c.isolation})
+	if err != nil {
+		return fmt.Errorf("console begin: %v", err)
+	}
+	c.tx = tx
+	return nil
+}
+
+func (c *Console) Isolation() sql.IsolationLevel {
+	return c.isolation
+}
+
+// Exec runs a single statement in the console's transaction. Only the
+// statements in the allowlist are accepted, on the demo tables of the
+// store's own schema, COMMIT and ROLLBACK end the transaction.
+func (c *Console) Exec(ctx context.Context, stmt string) (Table, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tx == nil {
+		return Table{}, errors.New("the console lost its connection, open another one")
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, consoleTimeout)
+	defer cancel()
+	stop := context.AfterFunc(c.ctx, cancel)
+	defer stop()
+
+	stmt = strings.TrimSpace(stmt)
+	stmt = strings.TrimSpace(strings.TrimSuffix(stmt, ";"))
+	tokens, err := sqlTokens(c.dialect, stmt)
+	if err != nil {
+		return Table{}, fmt.Errorf("%w: %v", ErrStatementNotAllowed, err)
+	}
+	for _, t := range tokens {
+		if t.is(sqlPunct, ";") {
+			return Table{}, fmt.Errorf("%w: only a single statement can be run", ErrStatementNotAllowed)
+		}
+	}
+	if c.dialect == SQLite && !sqliteSingleStatement(stmt) {
+		return Table{}, fmt.Errorf("%w: only a single statement can be run", ErrStatementNotAllowed)
+	}
+
+	var keyword string
+	if len(tokens) > 0 && tokens[0].kind == sqlWord {
+		keyword = tokens[0].text
+	}
+	switch keyword {
+	case "COMMIT":
+		return Table{}, c.end(c.tx.Commit)
+	case "ROLLBACK":
+		return Table{}, c.end(c.tx.Rollback)
+	}
+
+	returnsRows, ok := consoleStatements[keyword]
+	if !ok {
+		return Table{}, fmt.Errorf("%w: %s", ErrStatementNotAllowed, keyword)
+	}
+	if err := checkTables(tokens); err != nil {
+		return Table{}, fmt.Errorf("%w: %v", ErrStatementNotAllowed, err)
+	}
+
+	t, err := c.exec(runCtx, stmt, returnsRows)
+	if err != nil && isTimeout(ctx, runCtx, err) {
+		// The driver gives up on the connection of a statement it stops,
+		// the console starts over on another one.
+		return Table{}, errors.Join(
+			fmt.Errorf("%w after %s, the transaction was rolled back", ErrQueryTimeout, consoleTimeout),
+			c.reconnect(),
+		)
+	}
+	return t, err
+}
+
+func (c *Console) exec(ctx context.Context, stmt string, returnsRows bool) (Table, error) {
+	if returnsRows {
+		return queryTable(ctx, c.tx, stmt, consoleMaxRows)
+	}
+
+	res, err := c.tx.ExecContext(ctx, stmt)
+	if err != nil {
+		return Table{}, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return Table{}, err
+	}
+
+	return Table{Affected: affected}, nil
+}
+
+func (c *Console) Commit() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tx == nil {
+		return sql.ErrTxDone
+	}
+	return c.end(c.tx.Commit)
+}
+
+func (c *Console) Rollback() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tx == nil {
+		return sql.ErrTxDone
+	}
+	return c.end(c.tx.Rollback)
+}
+
+func (c *Console) end(endTx func() error) error {
+	if err := endTx(); err != nil {
+		return err
+	}
+	return c.begin()
+}
+
+func (c *Console) reconnect() error {
+	c.tx.Rollback()
+	c.tx = nil
+	if err := c.disconnect(); err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	return c.begin()
+}
+
+// Close rolls back the open transaction and returns the connection to the
+// pool, any statement still running is cancelled.
+func (c *Console) Close() error {
+	c.cancel()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tx != nil {
+		if err := c.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			return errors.Join(err, c.disconnect())
+		}
+	}
+	return c.disconnect()
+}
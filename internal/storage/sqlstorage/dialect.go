@@ -0,0 +1,140 @@
+package sqlstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Dialect is the database backend the demo data is stored in.
+type Dialect string
+
+const (
+	MySQL  Dialect = "mysql"
+	SQLite Dialect = "sqlite"
+)
+
+type Config struct {
+	Dialect Dialect
+	// DSN is passed to the driver of the dialect, the default is used when
+	// empty.
+	DSN string
+}
+
+var drivers = map[Dialect]string{
+	MySQL:  "mysql",
+	SQLite: "sqlite",
+}
+
+var defaultDSNs = map[Dialect]string{
+	MySQL: "detest:detest@tcp(localhost:3306)/detest",
+	// WAL lets readers run alongside a writer and the busy timeout makes
+	// a transaction wait on a lock instead of failing straight away.
+	SQLite: "file:de.db?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)",
+}
+
+var schemas = map[Dialect][]string{
+	MySQL: {`
+		CREATE TABLE IF NOT EXISTS accounts (
+			id INT AUTO_INCREMENT,
+			balance INT NOT NULL,
+			PRIMARY KEY (id)
+		);
+`, `
+		CREATE TABLE IF NOT EXISTS employees (
+			id INT AUTO_INCREMENT,
+			name VARCHAR(300) NOT NULL,
+			name2 VARCHAR(300) NOT NULL,
+			PRIMARY KEY (id),
+			INDEX(name)
+		);
+`},
+	SQLite: {`
+		CREATE TABLE IF NOT EXISTS accounts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			balance INT NOT NULL
+		);
+`, `
+		CREATE TABLE IF NOT EXISTS employees (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name VARCHAR(300) NOT NULL,
+			name2 VARCHAR(300) NOT NULL
+		);
+`, `
+		CREATE INDEX IF NOT EXISTS name ON employees (name);
+`},
+}
+
+// salesSchemas create a sales table named by the format argument, the shared
+// one or a scratch copy.
+var salesSchemas = map[Dialect]string{
+	MySQL: `
+		CREATE TABLE IF NOT EXISTS %s (
+			id INT AUTO_INCREMENT,
+			quantity INT NOT NULL,
+			price INT NOT NULL,
+			version INT NOT NULL DEFAULT 0,
+			PRIMARY KEY (id)
+		);
+`,
+	SQLite: `
+		CREATE TABLE IF NOT EXISTS %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			quantity INT NOT NULL,
+			price INT NOT NULL,
+			version INT NOT NULL DEFAULT 0
+		);
+`,
+}
+
+// jobsSchemas create a job queue named by the format argument.
+var jobsSchemas = map[Dialect][]string{
+	MySQL: {`
+		CREATE TABLE %[1]s (
+			id INT AUTO_INCREMENT,
+			status VARCHAR(16) NOT NULL,
+			worker INT,
+			PRIMARY KEY (id),
+			INDEX (status, id)
+		);
+`},
+	SQLite: {`
+		CREATE TABLE %[1]s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			status VARCHAR(16) NOT NULL,
+			worker INT
+		);
+`, `
+		CREATE INDEX %[1]s_status ON %[1]s (status, id);
+`},
+}
+
+// listTablesQueries list the tables whose name starts with the argument.
+var listTablesQueries = map[Dialect]string{
+	MySQL: `
+	SELECT table_name FROM information_schema.tables
+	WHERE table_schema = DATABASE() AND table_name LIKE CONCAT(?, '%')
+	`,
+	SQLite: `
+	SELECT name FROM sqlite_master
+	WHERE type = 'table' AND name LIKE ? || '%'
+	`,
+}
+
+var ErrUnsupported = errors.New("not supported by this dialect")
+
+// truncate empties a table and resets its ids.
+func (s *Store) truncate(ctx context.Context, table string) error {
+	switch s.Dialect {
+	case MySQL:
+		_, err := s.DB.ExecContext(ctx, "TRUNCATE "+table)
+		return err
+	case SQLite:
+		if _, err := s.DB.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+			return err
+		}
+		_, err := s.DB.ExecContext(ctx, "DELETE FROM sqlite_sequence WHERE name = ?", table)
+		return err
+	}
+	return fmt.Errorf("truncate %s: %w", s.Dialect, ErrUnsupported)
+}
@@ -3,6 +3,9 @@ package sqlstorage
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 )
 
 func (s *Store) CountEmployees(ctx context.Context) (uint64, error) {
@@ -14,193 +17,214 @@ func (s *Store) CountEmployees(ctx context.Context) (uint64, error) {
 	return count, nil
 }
 
-func (s *Store) AnalyzePaginationCAll(ctx context.Context) (string, error) {
-	const query = `
-	EXPLAIN ANALYZE SELECT *
-	FROM employees
-	WHERE id < 121452 ORDER BY id DESC
-    LIMIT 10;
-	`
-	return s.analyzeQuery(ctx, query)
+// AnalyzeCase analyzes the query of a catalog case in the store's dialect.
+func (s *Store) AnalyzeCase(ctx context.Context, c QueryCase) (Plan, error) {
+	plan, err := s.Analyze(ctx, c.Query(s.Dialect))
+	if err != nil {
+		return Plan{}, fmt.Errorf("analyze %s: %v", c.Name, err)
+	}
+	return plan, nil
+}
+
+// Analyze runs the query with EXPLAIN ANALYZE and returns the plan with the
+// time spent in each step. SQLite has no EXPLAIN ANALYZE, the plan it would
+// use is returned instead, indented like the MySQL one.
+func (s *Store) Analyze(ctx context.Context, query string) (Plan, error) {
+	return s.analyze(ctx, s.DB, query)
+}
+
+func (s *Store) analyze(ctx context.Context, conn dbTx, query string) (Plan, error) {
+	var text string
+	var err error
+	switch s.Dialect {
+	case MySQL:
+		err = conn.QueryRowContext(ctx, "EXPLAIN ANALYZE "+query).Scan(&text)
+	case SQLite:
+		text, err = queryPlan(ctx, conn, query)
+	default:
+		err = fmt.Errorf("analyze: %s: %w", s.Dialect, ErrUnsupported)
+	}
+	if err != nil {
+		return Plan{}, err
+	}
+	return ParsePlan(s.Dialect, text), nil
 }
 
-func (s *Store) AnalyzePaginationLOAll(ctx context.Context) (string, error) {
-	const query = `
-	EXPLAIN ANALYZE SELECT *
-	FROM employees
-	ORDER BY id DESC LIMIT 10 OFFSET 876550;
-	`
-	return s.analyzeQuery(ctx, query)
-}
+// queryPlan formats the rows of EXPLAIN QUERY PLAN, each a step of the plan
+// under its parent.
+func queryPlan(ctx context.Context, conn dbTx, query string) (string, error) {
+	rows, err := conn.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	depth := map[int]int{}
+	var b strings.Builder
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return "", err
+		}
+		depth[id] = depth[parent] + 1
+		fmt.Fprintf(&b, "%s-> %s\n", strings.Repeat("    ", depth[id]-1), detail)
+	}
 
-func (s *Store) AnalyzePaginationCNameName2(ctx context.Context) (string, error) {
-	const query = `
-	EXPLAIN ANALYZE SELECT id, name, name2
-	FROM employees
-	WHERE id < 121452 ORDER BY id DESC
-    LIMIT 10;
-	`
-	return s.analyzeQuery(ctx, query)
-}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
 
-func (s *Store) AnalyzePaginationLONameName2(ctx context.Context) (string, error) {
-	const query = `
-	EXPLAIN ANALYZE SELECT id, name, name2
-	FROM employees
-	ORDER BY id DESC LIMIT 10 OFFSET 876550;
-	`
-	return s.analyzeQuery(ctx, query)
+	return b.String(), nil
 }
 
-func (s *Store) AnalyzePaginationCName(ctx context.Context) (string, error) {
-	const query = `
-	EXPLAIN ANALYZE SELECT id, name
-	FROM employees
-	WHERE id < 121452 ORDER BY id DESC
-    LIMIT 10;
-	`
-	return s.analyzeQuery(ctx, query)
+type Employee struct {
+	ID    uint64 `json:"id"`
+	Name  string `json:"name"`
+	Name2 string `json:"name2"`
 }
 
-func (s *Store) AnalyzePaginationLOName(ctx context.Context) (string, error) {
-	const query = `
-	EXPLAIN ANALYZE SELECT id, name
-	FROM employees
-	ORDER BY id DESC LIMIT 10 OFFSET 876550;
-	`
-	return s.analyzeQuery(ctx, query)
-}
+// EmployeeSort is the order employees are listed in, names are not unique so
+// employees of the same name are listed by id.
+type EmployeeSort string
 
-func (s *Store) analyzeQuery(
-	ctx context.Context,
-	query string,
-) (string, error) {
-	row := s.DB.QueryRowContext(ctx, query)
-	var result string
-	if err := row.Scan(&result); err != nil {
-		return "", fmt.Errorf("explain analyze * employee: %v", err)
-	}
+const (
+	EmployeesByID   EmployeeSort = "id"
+	EmployeesByName EmployeeSort = "name"
+)
 
-	return result, nil
+var employeeOrders = map[EmployeeSort]string{
+	EmployeesByID:   "id",
+	EmployeesByName: "name, id",
 }
 
-func (s *Store) AnalyzePaginationCursor(
-	ctx context.Context,
-) (string, error) {
-	const query = `
-	EXPLAIN ANALYZE SELECT id FROM employees WHERE id < 121452 ORDER BY id DESC
-    LIMIT 10;
-	`
-	row := s.DB.QueryRowContext(ctx, query)
-	var result string
-	if err := row.Scan(&result); err != nil {
-		return "", fmt.Errorf("explain analyze * employee: %v", err)
-	}
-
-	return result, nil
+// employeeKeyConditions select the employees after a key in each order, the
+// arguments are the name then the id of the key.
+var employeeKeyConditions = map[EmployeeSort]string{
+	EmployeesByID:   "id > ?",
+	EmployeesByName: "(name > ? OR (name = ? AND id > ?))",
 }
 
-func (s *Store) AnalyzePaginationLimitOffset(
-	ctx context.Context,
-) (string, error) {
-	const query = `
-	EXPLAIN ANALYZE SELECT id FROM employees ORDER BY id DESC LIMIT 10 OFFSET 876550;
-	`
-	row := s.DB.QueryRowContext(ctx, query)
-	var result string
-	if err := row.Scan(&result); err != nil {
-		return "", fmt.Errorf("explain analyze * employee: %v", err)
-	}
-
-	return result, nil
+// EmployeeKey is the position of an employee in a sort, the employees listed
+// after it are those with a greater key.
+type EmployeeKey struct {
+	ID   uint64 `json:"id"`
+	Name string `json:"name,omitempty"`
 }
 
-func (s *Store) AnalyzeAllColumnSelect(
-	ctx context.Context,
-) (string, error) {
-	const query = `
-	EXPLAIN ANALYZE SELECT * FROM employees WHERE id = 777;
-	`
-	row := s.DB.QueryRowContext(ctx, query)
-	var result string
-	if err := row.Scan(&result); err != nil {
-		return "", fmt.Errorf("explain analyze * employee: %v", err)
-	}
+func (e Employee) Key() EmployeeKey {
+	return EmployeeKey{ID: e.ID, Name: e.Name}
+}
 
-	return result, nil
+// EmployeePage is a page of employees in sort order.
+type EmployeePage struct {
+	Employees []Employee    `json:"employees"`
+	Query     string        `json:"query"`
+	Elapsed   time.Duration `json:"elapsed"`
+	// More tells there are employees past the page, in the direction it
+	// was read in.
+	More bool `json:"more"`
 }
 
-func (s *Store) AnalyzePrimaryKeyPlusIndexSelect(
-	ctx context.Context,
-) (string, error) {
-	const query = `
-	EXPLAIN ANALYZE SELECT id, name FROM employees where id = 777;
-	`
-	row := s.DB.QueryRowContext(ctx, query)
-	var result string
-	if err := row.Scan(&result); err != nil {
-		return "", fmt.Errorf("explain analyze employee: %v", err)
+func ParseEmployeeSort(name string) (EmployeeSort, error) {
+	sort := EmployeeSort(name)
+	if _, ok := employeeOrders[sort]; !ok {
+		return "", fmt.Errorf("unknown employee sort %q", name)
 	}
-
-	return result, nil
+	return sort, nil
 }
 
-func (s *Store) AnalyzeAllExplicitIndexSelect(
+// EmployeesByOffset lists the employees of a page, skipping the offset
+// employees before it.
+func (s *Store) EmployeesByOffset(
 	ctx context.Context,
-) (string, error) {
-	const query = `
-	EXPLAIN ANALYZE SELECT id, name, name2 FROM employees where id = 777;
-	`
-	row := s.DB.QueryRowContext(ctx, query)
-	var result string
-	if err := row.Scan(&result); err != nil {
-		return "", fmt.Errorf("explain analyze employee: %v", err)
+	sort EmployeeSort,
+	offset, limit int,
+) (EmployeePage, error) {
+	order, ok := employeeOrders[sort]
+	if !ok {
+		return EmployeePage{}, fmt.Errorf("unknown employee sort %q", sort)
 	}
 
-	return result, nil
+	query := fmt.Sprintf(
+		"SELECT id, name, name2 FROM employees ORDER BY %s LIMIT %d OFFSET %d",
+		order, limit+1, offset,
+	)
+	return s.employeePage(ctx, query, limit, false)
 }
 
-func (s *Store) AnalyzePrimaryKeySelect(
+// EmployeesByKey lists the employees of a page by seeking to a key, the page
+// starts after it or ends before it when backward. Without a key the page is
+// the first one, or the last one when backward.
+func (s *Store) EmployeesByKey(
 	ctx context.Context,
-) (string, error) {
-	const query = `
-	EXPLAIN ANALYZE SELECT id FROM employees where id = 777;
-	`
-	row := s.DB.QueryRowContext(ctx, query)
-	var result string
-	if err := row.Scan(&result); err != nil {
-		return "", fmt.Errorf("explain analyze pk employee: %v", err)
+	sort EmployeeSort,
+	key *EmployeeKey,
+	backward bool,
+	limit int,
+) (EmployeePage, error) {
+	order, ok := employeeOrders[sort]
+	if !ok {
+		return EmployeePage{}, fmt.Errorf("unknown employee sort %q", sort)
 	}
 
-	return result, nil
+	var where string
+	var args []any
+	if key != nil {
+		where = "WHERE " + employeeKeyConditions[sort] + " "
+		if sort == EmployeesByName {
+			args = append(args, key.Name, key.Name)
+		}
+		args = append(args, key.ID)
+	}
+	if backward {
+		// Read backward from the key, the page is put back in order.
+		order = strings.ReplaceAll(order, ",", " DESC,") + " DESC"
+		where = strings.ReplaceAll(where, ">", "<")
+	}
+
+	query := fmt.Sprintf("SELECT id, name, name2 FROM employees %sORDER BY %s LIMIT %d", where, order, limit+1)
+	return s.employeePage(ctx, query, limit, backward, args...)
 }
 
-func (s *Store) AnalyzeIndexedColumnSelect(
+// employeePage runs a query of a page reading one employee more than the
+// limit, which tells whether there are more.
+func (s *Store) employeePage(
 	ctx context.Context,
-) (string, error) {
-	const query = `
-	EXPLAIN ANALYZE SELECT name FROM employees WHERE name = 777;
-	`
-	row := s.DB.QueryRowContext(ctx, query)
-	var result string
-	if err := row.Scan(&result); err != nil {
-		return "", fmt.Errorf("explain analyze pk employee: %v", err)
+	query string,
+	limit int,
+	backward bool,
+	args ...any,
+) (EmployeePage, error) {
+	page := EmployeePage{Query: query}
+
+	start := time.Now()
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return EmployeePage{}, fmt.Errorf("list employees: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e Employee
+		if err := rows.Scan(&e.ID, &e.Name, &e.Name2); err != nil {
+			return EmployeePage{}, err
+		}
+		page.Employees = append(page.Employees, e)
 	}
 
-	return result, nil
-}
+	if err := rows.Err(); err != nil {
+		return EmployeePage{}, fmt.Errorf("list employees: %v", err)
+	}
+	page.Elapsed = time.Since(start)
 
-func (s *Store) AnalyzeUnindexedColumnSelect(
-	ctx context.Context,
-) (string, error) {
-	const query = `
-	EXPLAIN ANALYZE SELECT name2 FROM employees where name2 = 777;
-	`
-	row := s.DB.QueryRowContext(ctx, query)
-	var result string
-	if err := row.Scan(&result); err != nil {
-		return "", fmt.Errorf("explain analyze unindexed employee: %v", err)
+	if len(page.Employees) > limit {
+		page.More = true
+		page.Employees = page.Employees[:limit]
+	}
+	if backward {
+		slices.Reverse(page.Employees)
 	}
 
-	return result, nil
+	return page, nil
 }
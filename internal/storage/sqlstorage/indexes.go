@@ -0,0 +1,197 @@
+package sqlstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Index is an index of a demo table.
+type Index struct {
+	Table   string   `json:"table"`
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+}
+
+// Primary tells the index is the primary key of its table, which is not
+// dropped.
+func (i Index) Primary() bool {
+	return i.Name == "PRIMARY"
+}
+
+var ErrIndexNotAllowed = errors.New("index change not allowed")
+
+var indexNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// listIndexesQueries list the columns of the indexes of the demo tables, in
+// the order of the index.
+var listIndexesQueries = map[Dialect]string{
+	MySQL: `
+	SELECT table_name, index_name, column_name, non_unique = 0
+	FROM information_schema.statistics
+	WHERE table_schema = DATABASE() AND table_name IN (?, ?, ?)
+	ORDER BY table_name, index_name = 'PRIMARY' DESC, index_name, seq_in_index
+	`,
+	// The rowid of a table is its primary key, it is not an index.
+	SQLite: `
+	SELECT m.name, il.name, ii.name, il."unique"
+	FROM sqlite_master AS m
+	JOIN pragma_index_list(m.name) AS il
+	JOIN pragma_index_info(il.name) AS ii
+	WHERE m.type = 'table' AND m.name IN (?, ?, ?)
+	ORDER BY m.name, il.name, ii.seqno
+	`,
+}
+
+var tableColumnsQueries = map[Dialect]string{
+	MySQL: `
+	SELECT column_name FROM information_schema.columns
+	WHERE table_schema = DATABASE() AND table_name = ?
+	ORDER BY ordinal_position
+	`,
+	SQLite: `SELECT name FROM pragma_table_info(?) ORDER BY cid`,
+}
+
+// DemoTables are the tables indexes can be managed on.
+func DemoTables() []string {
+	return slices.Clone(demoTables)
+}
+
+// ListIndexes returns the indexes of the demo tables, by table.
+func (s *Store) ListIndexes(ctx context.Context) ([]Index, error) {
+	query, ok := listIndexesQueries[s.Dialect]
+	if !ok {
+		return nil, fmt.Errorf("list indexes: %s: %w", s.Dialect, ErrUnsupported)
+	}
+	args := make([]any, len(demoTables))
+	for i, t := range demoTables {
+		args[i] = t
+	}
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list indexes: %v", err)
+	}
+	defer rows.Close()
+
+	var indexes []Index
+	for rows.Next() {
+		var table, name, column string
+		var unique bool
+		if err := rows.Scan(&table, &name, &column, &unique); err != nil {
+			return nil, err
+		}
+		if n := len(indexes); n > 0 && indexes[n-1].Table == table && indexes[n-1].Name == name {
+			indexes[n-1].Columns = append(indexes[n-1].Columns, column)
+			continue
+		}
+		indexes = append(indexes, Index{
+			Table:   table,
+			Name:    name,
+			Columns: []string{column},
+			Unique:  unique,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return indexes, nil
+}
+
+// TableColumns returns the columns of a demo table.
+func (s *Store) TableColumns(ctx context.Context, table string) ([]string, error) {
+	if !slices.Contains(demoTables, table) {
+		return nil, fmt.Errorf("%w: %q is not a demo table", ErrIndexNotAllowed, table)
+	}
+
+	rows, err := s.DB.QueryContext(ctx, tableColumnsQueries[s.Dialect], table)
+	if err != nil {
+		return nil, fmt.Errorf("columns of %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return columns, nil
+}
+
+// CreateIndex indexes the columns of a demo table, in the order given. An
+// index over more than one column is composite, and covering for the queries
+// that read none but its columns.
+func (s *Store) CreateIndex(ctx context.Context, index Index) error {
+	if !indexNameRe.MatchString(index.Name) || strings.EqualFold(index.Name, "PRIMARY") {
+		return fmt.Errorf("%w: invalid index name %q", ErrIndexNotAllowed, index.Name)
+	}
+	if len(index.Columns) == 0 {
+		return fmt.Errorf("%w: an index needs at least one column", ErrIndexNotAllowed)
+	}
+
+	columns, err := s.TableColumns(ctx, index.Table)
+	if err != nil {
+		return err
+	}
+	for i, c := range index.Columns {
+		if !slices.Contains(columns, c) {
+			return fmt.Errorf("%w: %s has no column %q", ErrIndexNotAllowed, index.Table, c)
+		}
+		if slices.Contains(index.Columns[:i], c) {
+			return fmt.Errorf("%w: column %q is listed twice", ErrIndexNotAllowed, c)
+		}
+	}
+
+	stmt := "CREATE INDEX "
+	if index.Unique {
+		stmt = "CREATE UNIQUE INDEX "
+	}
+	stmt += index.Name + " ON " + index.Table + " (" + strings.Join(index.Columns, ", ") + ")"
+	if _, err := s.DB.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("create index %s: %v", index.Name, err)
+	}
+	return nil
+}
+
+// DropIndex drops an index of a demo table, primary keys are kept.
+func (s *Store) DropIndex(ctx context.Context, table, name string) error {
+	indexes, err := s.ListIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(indexes, func(i Index) bool { return i.Table == table && i.Name == name })
+	switch {
+	case i < 0:
+		return fmt.Errorf("%w: %s has no index %q", ErrIndexNotAllowed, table, name)
+	case indexes[i].Primary():
+		return fmt.Errorf("%w: the primary key of %s is kept", ErrIndexNotAllowed, table)
+	}
+
+	var stmt string
+	switch s.Dialect {
+	case MySQL:
+		stmt = "DROP INDEX " + name + " ON " + table
+	case SQLite:
+		stmt = "DROP INDEX " + name
+	default:
+		return fmt.Errorf("drop index: %s: %w", s.Dialect, ErrUnsupported)
+	}
+	if _, err := s.DB.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("drop index %s: %v", name, err)
+	}
+	return nil
+}
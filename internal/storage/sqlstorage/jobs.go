@@ -0,0 +1,152 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ClaimStrategy is how a worker claims the next pending job of a queue.
+type ClaimStrategy string
+
+const (
+	// ClaimPlain reads the next pending job without locking it, concurrent
+	// workers may claim and process the same job.
+	ClaimPlain ClaimStrategy = "plain"
+	// ClaimForUpdate locks the job it reads, concurrent workers wait for the
+	// lock and then move on to the next pending job.
+	ClaimForUpdate ClaimStrategy = "for-update"
+	// ClaimNoWait fails straight away when the job is locked by another
+	// worker instead of waiting.
+	ClaimNoWait ClaimStrategy = "nowait"
+	// ClaimSkipLocked passes over the jobs locked by other workers.
+	ClaimSkipLocked ClaimStrategy = "skip-locked"
+)
+
+var ClaimStrategies = []ClaimStrategy{ClaimPlain, ClaimForUpdate, ClaimNoWait, ClaimSkipLocked}
+
+var claimClauses = map[ClaimStrategy]string{
+	ClaimPlain:      "",
+	ClaimForUpdate:  " FOR UPDATE",
+	ClaimNoWait:     " FOR UPDATE NOWAIT",
+	ClaimSkipLocked: " FOR UPDATE SKIP LOCKED",
+}
+
+// Clause is the locking clause the strategy adds to the claim query.
+func (c ClaimStrategy) Clause() string {
+	return claimClauses[c]
+}
+
+var (
+	ErrNoJobs = errors.New("no pending job")
+	// ErrLockNotAvailable is returned by a NOWAIT claim of a locked job.
+	ErrLockNotAvailable = errors.New("job is locked by another worker")
+)
+
+// mysqlLockNowait is the error MySQL returns when a NOWAIT locking read
+// finds a locked row.
+const mysqlLockNowait = 3572
+
+// maxJobs bounds the jobs of a queue, they are generated by a recursive
+// query which MySQL limits to 1000 levels by default.
+const maxJobs = 1000
+
+// scratchJobsPrefix starts the names of the scratch job queues.
+const scratchJobsPrefix = "de_scratch_jobs_"
+
+// JobsTable is a queue of jobs owned by a single run of the job queue
+// lesson, workers claim its pending jobs and mark them done.
+type JobsTable struct {
+	store *Store
+	Name  string
+}
+
+// CreateScratchJobs creates a uniquely named queue of n pending jobs, it is
+// dropped with Drop once no longer needed.
+func (s *Store) CreateScratchJobs(ctx context.Context, n int) (JobsTable, error) {
+	if n < 1 || n > maxJobs {
+		return JobsTable{}, fmt.Errorf("a queue holds between 1 and %d jobs", maxJobs)
+	}
+
+	name, err := scratchTableName(scratchJobsPrefix)
+	if err != nil {
+		return JobsTable{}, err
+	}
+
+	t := JobsTable{store: s, Name: name}
+	for _, stmt := range jobsSchemas[s.Dialect] {
+		if _, err := s.DB.ExecContext(ctx, fmt.Sprintf(stmt, t.Name)); err != nil {
+			return JobsTable{}, errors.Join(fmt.Errorf("create %s: %v", t.Name, err), t.Drop(ctx))
+		}
+	}
+
+	insertQuery := `
+	INSERT INTO ` + t.Name + ` (status)
+	WITH RECURSIVE cte (n) AS (
+		SELECT 1
+		UNION ALL
+		SELECT n + 1
+		FROM cte WHERE n < ?
+	)
+	SELECT 'pending' FROM cte
+	`
+	if _, err := s.DB.ExecContext(ctx, insertQuery, n); err != nil {
+		return JobsTable{}, errors.Join(fmt.Errorf("populate %s: %v", t.Name, err), t.Drop(ctx))
+	}
+
+	return t, nil
+}
+
+func (t JobsTable) Drop(ctx context.Context) error {
+	if _, err := t.store.DB.ExecContext(ctx, "DROP TABLE IF EXISTS "+t.Name); err != nil {
+		return fmt.Errorf("drop %s: %v", t.Name, err)
+	}
+	return nil
+}
+
+// Claim reads the next pending job in the transaction with the strategy,
+// SQLite only supports the plain claim as it has no row locks.
+func (t JobsTable) Claim(
+	ctx context.Context,
+	tx *sql.Tx,
+	strategy ClaimStrategy,
+) (uint64, error) {
+	clause, ok := claimClauses[strategy]
+	if !ok {
+		return 0, fmt.Errorf("unknown claim strategy %q", strategy)
+	}
+	if t.store.Dialect != MySQL && strategy != ClaimPlain {
+		return 0, fmt.Errorf("claim %s: %s: %w", strategy, t.store.Dialect, ErrUnsupported)
+	}
+
+	query := "SELECT id FROM " + t.Name + " WHERE status = 'pending' ORDER BY id LIMIT 1" + clause
+	var id uint64
+	err := tx.QueryRowContext(ctx, query).Scan(&id)
+	var myErr *mysql.MySQLError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, ErrNoJobs
+	case errors.As(err, &myErr) && myErr.Number == mysqlLockNowait:
+		return 0, ErrLockNotAvailable
+	case err != nil:
+		return 0, err
+	}
+	return id, nil
+}
+
+// Complete marks a job done by the worker.
+func (t JobsTable) Complete(
+	ctx context.Context,
+	tx *sql.Tx,
+	id uint64,
+	worker int,
+) error {
+	query := "UPDATE " + t.Name + " SET status = 'done', worker = ? WHERE id = ?"
+	if _, err := tx.ExecContext(ctx, query, worker, id); err != nil {
+		return fmt.Errorf("complete job %d: %v", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package sqlstorage
+
+import (
+	"context"
+	"fmt"
+)
+
+// Lock is a lock held or waited on by an InnoDB transaction, as reported by
+// performance_schema.data_locks.
+type Lock struct {
+	TrxID  string `json:"trx"`
+	Table  string `json:"table"`
+	Index  string `json:"index"`
+	Type   string `json:"type"`
+	Mode   string `json:"mode"`
+	Status string `json:"status"`
+	Data   string `json:"data"`
+}
+
+// LockWait is a transaction blocked on a lock held by another.
+type LockWait struct {
+	RequestingTrxID string `json:"requesting"`
+	BlockingTrxID   string `json:"blocking"`
+}
+
+// Trx is a running InnoDB transaction from information_schema.innodb_trx.
+type Trx struct {
+	ID         string `json:"id"`
+	ThreadID   uint64 `json:"thread"`
+	State      string `json:"state"`
+	Isolation  string `json:"isolation"`
+	RowsLocked uint64 `json:"rowsLocked"`
+	Query      string `json:"query"`
+}
+
+type LockSnapshot struct {
+	Locks        []Lock     `json:"locks"`
+	Waits        []LockWait `json:"waits"`
+	Transactions []Trx      `json:"transactions"`
+}
+
+// InspectLocks reads the locks held on a table and the transactions holding
+// them, or on every demo table when table is empty. It runs outside of any
+// transaction so it sees locks taken by transactions that have not committed.
+func (s *Store) InspectLocks(ctx context.Context, table string) (LockSnapshot, error) {
+	if s.Dialect != MySQL {
+		return LockSnapshot{}, fmt.Errorf("inspect locks: %s: %w", s.Dialect, ErrUnsupported)
+	}
+
+	var snap LockSnapshot
+	var err error
+	if snap.Locks, err = s.dataLocks(ctx, table); err != nil {
+		return LockSnapshot{}, fmt.Errorf("inspect data locks: %v", err)
+	}
+	if snap.Waits, err = s.dataLockWaits(ctx); err != nil {
+		return LockSnapshot{}, fmt.Errorf("inspect data lock waits: %v", err)
+	}
+	if snap.Transactions, err = s.innodbTrx(ctx); err != nil {
+		return LockSnapshot{}, fmt.Errorf("inspect innodb transactions: %v", err)
+	}
+
+	if table != "" {
+		snap = snap.only(table)
+	}
+	return snap, nil
+}
+
+// only keeps the waits and transactions of the locks held on the table.
+func (snap LockSnapshot) only(table string) LockSnapshot {
+	trxs := map[string]bool{}
+	for _, l := range snap.Locks {
+		trxs[l.TrxID] = true
+	}
+
+	var waits []LockWait
+	for _, w := range snap.Waits {
+		if trxs[w.RequestingTrxID] {
+			waits = append(waits, w)
+		}
+	}
+	var transactions []Trx
+	for _, t := range snap.Transactions {
+		if trxs[t.ID] {
+			transactions = append(transactions, t)
+		}
+	}
+
+	snap.Waits = waits
+	snap.Transactions = transactions
+	return snap
+}
+
+func (s *Store) dataLocks(ctx context.Context, table string) ([]Lock, error) {
+	const query = `
+	SELECT ENGINE_TRANSACTION_ID, OBJECT_NAME, COALESCE(INDEX_NAME, ''),
+		LOCK_TYPE, LOCK_MODE, LOCK_STATUS, COALESCE(LOCK_DATA, '')
+	FROM performance_schema.data_locks
+	WHERE OBJECT_SCHEMA = DATABASE() AND (? = '' OR OBJECT_NAME = ?)
+	ORDER BY ENGINE_TRANSACTION_ID, OBJECT_NAME, LOCK_TYPE DESC, LOCK_DATA
+	`
+	rows, err := s.DB.QueryContext(ctx, query, table, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locks []Lock
+	for rows.Next() {
+		var l Lock
+		if err := rows.Scan(
+			&l.TrxID, &l.Table, &l.Index, &l.Type, &l.Mode, &l.Status, &l.Data,
+		); err != nil {
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return locks, nil
+}
+
+func (s *Store) dataLockWaits(ctx context.Context) ([]LockWait, error) {
+	const query = `
+	SELECT REQUESTING_ENGINE_TRANSACTION_ID, BLOCKING_ENGINE_TRANSACTION_ID
+	FROM performance_schema.data_lock_waits
+	`
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var waits []LockWait
+	for rows.Next() {
+		var w LockWait
+		if err := rows.Scan(&w.RequestingTrxID, &w.BlockingTrxID); err != nil {
+			return nil, err
+		}
+		waits = append(waits, w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return waits, nil
+}
+
+func (s *Store) innodbTrx(ctx context.Context) ([]Trx, error) {
+	const query = `
+	SELECT trx_id, trx_mysql_thread_id, trx_state, trx_isolation_level,
+		trx_rows_locked, COALESCE(trx_query, '')
+	FROM information_schema.innodb_trx
+	ORDER BY trx_started
+	`
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trxs []Trx
+	for rows.Next() {
+		var t Trx
+		if err := rows.Scan(
+			&t.ID, &t.ThreadID, &t.State, &t.Isolation, &t.RowsLocked, &t.Query,
+		); err != nil {
+			return nil, err
+		}
+		trxs = append(trxs, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return trxs, nil
+}
+
+// ConnectionID returns the id of the server thread running conn, it matches
+// the thread id of the transactions returned by InspectLocks. Dialects without
+// server threads always return 0.
+func (s *Store) ConnectionID(ctx context.Context, conn dbTx) (uint64, error) {
+	if s.Dialect != MySQL {
+		return 0, nil
+	}
+
+	var id uint64
+	if err := conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&id); err != nil {
+		return 0, fmt.Errorf("connection id: %v", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,284 @@
+package sqlstorage
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Plan is a query plan, the steps of the text output of EXPLAIN ANALYZE
+// parsed into a tree.
+type Plan struct {
+	Text  string      `json:"text"`
+	Nodes []*PlanNode `json:"nodes"`
+	// Warnings are those of every step, prefixed by the step's operator.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// PlanNode is a step of a query plan. The estimates are zero when the
+// database gives none, the actual figures are only set once the query ran.
+type PlanNode struct {
+	Operator string `json:"operator"`
+	Detail   string `json:"detail"`
+	Table    string `json:"table,omitempty"`
+	Index    string `json:"index,omitempty"`
+
+	Cost          float64 `json:"cost,omitempty"`
+	EstimatedRows float64 `json:"estimatedRows,omitempty"`
+	// Analyzed tells the step ran, even when its actual figures are zero.
+	Analyzed   bool    `json:"analyzed"`
+	ActualRows float64 `json:"actualRows,omitempty"`
+	Loops      int     `json:"loops,omitempty"`
+	// Time is the milliseconds the step took to return its last row, in
+	// each loop.
+	Time float64 `json:"time,omitempty"`
+
+	Warnings []string    `json:"warnings,omitempty"`
+	Children []*PlanNode `json:"children,omitempty"`
+}
+
+// Thresholds of the warnings of a plan: estimates off by at least
+// estimateErrorRatio and estimateErrorRows are flagged.
+const (
+	estimateErrorRatio = 10
+	estimateErrorRows  = 100
+)
+
+var (
+	mysqlCostRe   = regexp.MustCompile(`\(cost=(\S+) rows=(\S+)\)`)
+	mysqlRowsRe   = regexp.MustCompile(`\(rows=(\S+)\)`)
+	mysqlActualRe = regexp.MustCompile(`\(actual time=\S+\.\.(\S+) rows=(\S+) loops=(\d+)\)`)
+	mysqlTableRe  = regexp.MustCompile(`\bon (\S+)`)
+	mysqlIndexRe  = regexp.MustCompile(`\busing (\S+)`)
+
+	sqliteSearchRe = regexp.MustCompile(`^(SCAN|SEARCH) (\S+)(?: AS \S+)?(?: USING (?:COVERING )?INDEX (\S+)| USING (INTEGER PRIMARY KEY))?`)
+)
+
+// ParsePlan parses a plan as the store's analyze formats it, a step per line
+// indented under its parent and starting with an arrow.
+func ParsePlan(d Dialect, text string) Plan {
+	p := Plan{Text: text}
+
+	// The steps on the path from the root to the last one parsed.
+	var path []*PlanNode
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" {
+			continue
+		}
+		detail, ok := strings.CutPrefix(trimmed, "-> ")
+		if !ok {
+			// A step spanning lines, a long filter condition say.
+			if len(path) > 0 {
+				last := path[len(path)-1]
+				last.Detail += " " + trimmed
+			}
+			continue
+		}
+
+		n := &PlanNode{Detail: detail}
+		depth := min((len(line)-len(trimmed))/4, len(path))
+		path = path[:depth]
+		if depth == 0 {
+			p.Nodes = append(p.Nodes, n)
+		} else {
+			parent := path[depth-1]
+			parent.Children = append(parent.Children, n)
+		}
+		path = append(path, n)
+	}
+
+	walkPlan(p.Nodes, func(n *PlanNode) {
+		switch d {
+		case MySQL:
+			parseMySQLStep(n)
+		case SQLite:
+			parseSQLiteStep(n)
+		default:
+			n.Operator = n.Detail
+		}
+		n.Warnings = planWarnings(d, n)
+		for _, w := range n.Warnings {
+			p.Warnings = append(p.Warnings, n.Operator+": "+w)
+		}
+	})
+	return p
+}
+
+// RowsExamined adds up the rows the steps reading a table returned in every
+// loop, it is not known unless the query ran.
+func (p Plan) RowsExamined() (rows float64, ok bool) {
+	walkPlan(p.Nodes, func(n *PlanNode) {
+		if n.Analyzed && n.Table != "" {
+			rows += n.ActualRows * float64(n.Loops)
+			ok = true
+		}
+	})
+	return rows, ok
+}
+
+func walkPlan(nodes []*PlanNode, visit func(*PlanNode)) {
+	for _, n := range nodes {
+		visit(n)
+		walkPlan(n.Children, visit)
+	}
+}
+
+// parseMySQLStep reads a step of the TREE format of MySQL, of the form
+//
+//	Index lookup on employees using name (name='777')  (cost=1.1 rows=1) (actual time=0.02..0.03 rows=1 loops=1)
+func parseMySQLStep(n *PlanNode) {
+	desc := n.Detail
+	if i := strings.Index(desc, "  ("); i >= 0 {
+		desc = desc[:i]
+	}
+	n.Operator = desc
+	for _, sep := range []string{" on ", ": ", " using ", " ("} {
+		if i := strings.Index(n.Operator, sep); i >= 0 {
+			n.Operator = n.Operator[:i]
+		}
+	}
+	if m := mysqlTableRe.FindStringSubmatch(desc); m != nil {
+		n.Table = m[1]
+	}
+	if m := mysqlIndexRe.FindStringSubmatch(desc); m != nil {
+		n.Index = m[1]
+	}
+
+	if m := mysqlCostRe.FindStringSubmatch(n.Detail); m != nil {
+		n.Cost = parsePlanNumber(m[1])
+		n.EstimatedRows = parsePlanNumber(m[2])
+	} else if m := mysqlRowsRe.FindStringSubmatch(n.Detail); m != nil {
+		n.EstimatedRows = parsePlanNumber(m[1])
+	}
+	if m := mysqlActualRe.FindStringSubmatch(n.Detail); m != nil {
+		n.Analyzed = true
+		n.Time = parsePlanNumber(m[1])
+		n.ActualRows = parsePlanNumber(m[2])
+		n.Loops, _ = strconv.Atoi(m[3])
+	}
+}
+
+// parseSQLiteStep reads a step of EXPLAIN QUERY PLAN, of the form
+//
+//	SEARCH employees USING COVERING INDEX name (name=?)
+func parseSQLiteStep(n *PlanNode) {
+	m := sqliteSearchRe.FindStringSubmatch(n.Detail)
+	if m == nil {
+		n.Operator = n.Detail
+		return
+	}
+	n.Operator, n.Table = m[1], m[2]
+	switch {
+	case m[3] != "":
+		n.Index = m[3]
+	case m[4] != "":
+		n.Index = "PRIMARY KEY"
+	}
+}
+
+func parsePlanNumber(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+func planWarnings(d Dialect, n *PlanNode) []string {
+	var warnings []string
+
+	fullScan := false
+	switch d {
+	case MySQL:
+		fullScan = n.Operator == "Table scan" && !strings.HasPrefix(n.Table, "<")
+	case SQLite:
+		fullScan = n.Operator == "SCAN" && n.Index == "" && n.Table != "CONSTANT"
+	}
+	if fullScan {
+		warnings = append(warnings, fmt.Sprintf("full scan of %s", n.Table))
+	}
+
+	if n.Analyzed && n.EstimatedRows > 0 {
+		lo := max(min(n.EstimatedRows, n.ActualRows), 1)
+		hi := max(n.EstimatedRows, n.ActualRows)
+		if hi/lo >= estimateErrorRatio && hi-lo >= estimateErrorRows {
+			warnings = append(warnings, fmt.Sprintf(
+				"estimated %s rows, got %s",
+				strconv.FormatFloat(n.EstimatedRows, 'f', -1, 64),
+				strconv.FormatFloat(n.ActualRows, 'f', -1, 64),
+			))
+		}
+	}
+
+	return warnings
+}
+
+// tableAccesses describes how the plan reads each table, by table.
+func (p Plan) tableAccesses() map[string]string {
+	accesses := map[string]string{}
+	walkPlan(p.Nodes, func(n *PlanNode) {
+		if n.Table == "" {
+			return
+		}
+		access := n.Operator
+		if n.Index != "" {
+			access += " using " + n.Index
+		}
+		if a, ok := accesses[n.Table]; ok {
+			access = a + ", " + access
+		}
+		accesses[n.Table] = access
+	})
+	return accesses
+}
+
+// ComparePlans describes how the plan of the query labeled a differs from
+// the one labeled b, in the way they read their tables and the rows they
+// examined. It says so when they do not differ.
+func ComparePlans(aLabel string, a Plan, bLabel string, b Plan) []string {
+	var differences []string
+
+	aAccesses, bAccesses := a.tableAccesses(), b.tableAccesses()
+	tables := make([]string, 0, len(aAccesses))
+	for table := range aAccesses {
+		tables = append(tables, table)
+	}
+	for table := range bAccesses {
+		if _, ok := aAccesses[table]; !ok {
+			tables = append(tables, table)
+		}
+	}
+	slices.Sort(tables)
+	for _, table := range tables {
+		aAccess, bAccess := aAccesses[table], bAccesses[table]
+		if aAccess == bAccess {
+			continue
+		}
+		differences = append(differences, fmt.Sprintf(
+			"%s reads %s with %s, %s with %s",
+			aLabel, table, orNone(aAccess), bLabel, orNone(bAccess),
+		))
+	}
+
+	aRows, aOK := a.RowsExamined()
+	bRows, bOK := b.RowsExamined()
+	if aOK && bOK && aRows != bRows {
+		differences = append(differences, fmt.Sprintf(
+			"%s examines %s rows, %s %s",
+			aLabel, strconv.FormatFloat(aRows, 'f', -1, 64),
+			bLabel, strconv.FormatFloat(bRows, 'f', -1, 64),
+		))
+	}
+
+	if len(differences) == 0 {
+		return []string{fmt.Sprintf("%s and %s have the same plan", aLabel, bLabel)}
+	}
+	return differences
+}
+
+func orNone(access string) string {
+	if access == "" {
+		return "nothing"
+	}
+	return access
+}
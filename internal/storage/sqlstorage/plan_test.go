@@ -0,0 +1,144 @@
+package sqlstorage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// planSteps describes the steps of a plan a line each, indented under their
+// parent, with their operator, table and index.
+func planSteps(nodes []*PlanNode, depth int) []string {
+	var steps []string
+	for _, n := range nodes {
+		steps = append(steps, fmt.Sprintf("%s%s|%s|%s", strings.Repeat("  ", depth), n.Operator, n.Table, n.Index))
+		steps = append(steps, planSteps(n.Children, depth+1)...)
+	}
+	return steps
+}
+
+func TestParsePlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		dialect  Dialect
+		text     string
+		steps    []string
+		warnings []string
+		// examined is -1 when the plan does not tell the rows examined.
+		examined float64
+	}{
+		{
+			name:    "mysql join",
+			dialect: MySQL,
+			text: "-> Nested loop inner join  (cost=1.2 rows=1) (actual time=0.05..0.06 rows=1 loops=1)\n" +
+				"    -> Table scan on e  (cost=100805 rows=997209) (actual time=0.04..250 rows=998001 loops=1)\n" +
+				"    -> Single-row index lookup on a using PRIMARY (id=e.id)  (cost=0.25 rows=1) (actual time=0.01..0.01 rows=1 loops=998001)\n",
+			steps: []string{
+				"Nested loop inner join||",
+				"  Table scan|e|",
+				"  Single-row index lookup|a|PRIMARY",
+			},
+			warnings: []string{"Table scan: full scan of e"},
+			examined: 1996002,
+		},
+		{
+			name:    "mysql estimate off",
+			dialect: MySQL,
+			text: "-> Filter: (employees.name2 = 777)  (cost=100805 rows=99720) (actual time=120..300 rows=1 loops=1)\n" +
+				"    -> Table scan on employees  (cost=100805 rows=997209) (actual time=0.04..250 rows=998001 loops=1)\n",
+			steps: []string{
+				"Filter||",
+				"  Table scan|employees|",
+			},
+			warnings: []string{
+				"Filter: estimated 99720 rows, got 1",
+				"Table scan: full scan of employees",
+			},
+			examined: 998001,
+		},
+		{
+			name:    "mysql step spanning lines",
+			dialect: MySQL,
+			text: "-> Filter: ((employees.`name` = '1') or\n" +
+				"(employees.`name` = '2'))  (cost=3.1 rows=2)\n" +
+				"    -> Index range scan on employees using name over ('1') OR ('2')  (cost=3.1 rows=2)\n",
+			steps: []string{
+				"Filter||",
+				"  Index range scan|employees|name",
+			},
+			examined: -1,
+		},
+		{
+			name:    "mysql derived table",
+			dialect: MySQL,
+			text: "-> Table scan on <temporary>  (cost=2.5 rows=2)\n" +
+				"    -> Temporary table with deduplication  (cost=0 rows=0)\n" +
+				"        -> Covering index scan on employees using name  (cost=100805 rows=997209)\n",
+			steps: []string{
+				"Table scan|<temporary>|",
+				"  Temporary table with deduplication||",
+				"    Covering index scan|employees|name",
+			},
+			examined: -1,
+		},
+		{
+			name:    "sqlite",
+			dialect: SQLite,
+			text: "-> CO-ROUTINE s\n" +
+				"    -> SCAN employees USING COVERING INDEX name\n" +
+				"-> SEARCH employees AS e USING INDEX name (name=?)\n" +
+				"-> SEARCH a USING INTEGER PRIMARY KEY (rowid=?)\n" +
+				"-> SCAN s\n" +
+				"-> USE TEMP B-TREE FOR ORDER BY\n",
+			steps: []string{
+				"CO-ROUTINE s||",
+				"  SCAN|employees|name",
+				"SEARCH|employees|name",
+				"SEARCH|a|PRIMARY KEY",
+				"SCAN|s|",
+				"USE TEMP B-TREE FOR ORDER BY||",
+			},
+			warnings: []string{"SCAN: full scan of s"},
+			examined: -1,
+		},
+		{
+			name:     "sqlite constant row",
+			dialect:  SQLite,
+			text:     "-> SCAN CONSTANT ROW\n",
+			steps:    []string{"SCAN|CONSTANT|"},
+			examined: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := ParsePlan(tt.dialect, tt.text)
+			if steps := planSteps(p.Nodes, 0); !slices.Equal(steps, tt.steps) {
+				t.Errorf("steps = %q, want %q", steps, tt.steps)
+			}
+			if !slices.Equal(p.Warnings, tt.warnings) {
+				t.Errorf("warnings = %q, want %q", p.Warnings, tt.warnings)
+			}
+			examined, ok := p.RowsExamined()
+			if !ok {
+				examined = -1
+			}
+			if examined != tt.examined {
+				t.Errorf("rows examined = %v, want %v", examined, tt.examined)
+			}
+		})
+	}
+}
+
+func TestParsePlanFigures(t *testing.T) {
+	p := ParsePlan(MySQL, "-> Index lookup on employees using name (name='777')  (cost=1.1 rows=2) (actual time=0.02..0.035 rows=1 loops=3)\n")
+	if len(p.Nodes) != 1 {
+		t.Fatalf("got %d steps, want 1", len(p.Nodes))
+	}
+	n := p.Nodes[0]
+	if n.Cost != 1.1 || n.EstimatedRows != 2 || !n.Analyzed || n.Time != 0.035 || n.ActualRows != 1 || n.Loops != 3 {
+		t.Errorf("cost, estimate, analyzed, time, rows, loops = %v, %v, %v, %v, %v, %v, want 1.1, 2, true, 0.035, 1, 3",
+			n.Cost, n.EstimatedRows, n.Analyzed, n.Time, n.ActualRows, n.Loops)
+	}
+}
@@ -0,0 +1,504 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var ErrQueryTimeout = errors.New("query stopped")
+
+// mysqlExecutionTimeExceeded is the error MySQL returns when a query runs
+// past max_execution_time.
+const mysqlExecutionTimeExceeded = 3024
+
+// PlaygroundLimits bound a query run in the playground.
+type PlaygroundLimits struct {
+	Timeout time.Duration
+	// MaxRows is how many rows of the results are kept as a sample.
+	MaxRows int
+}
+
+// Explanation is what the playground found out about a query.
+type Explanation struct {
+	Query string `json:"query"`
+	// Plan is the output of EXPLAIN, or EXPLAIN QUERY PLAN on SQLite.
+	Plan Table `json:"plan"`
+	// Analysis is the output of EXPLAIN ANALYZE, SQLite has none so it is
+	// the plan without the actual figures.
+	Analysis Plan  `json:"analysis"`
+	Sample   Table `json:"sample"`
+	// Elapsed is how long fetching the sample took.
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// playgroundKeywords are the words that make a query more than a read, they
+// are rejected outside of strings and quoted names whatever their place.
+// UPDATE, SHARE and LOCK keep a read-only transaction from locking rows with
+// FOR UPDATE, FOR SHARE or LOCK IN SHARE MODE.
+var playgroundKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "REPLACE": true,
+	"MERGE": true, "UPSERT": true, "CREATE": true, "DROP": true,
+	"ALTER": true, "TRUNCATE": true, "RENAME": true, "GRANT": true,
+	"REVOKE": true, "ATTACH": true, "DETACH": true, "PRAGMA": true,
+	"VACUUM": true, "REINDEX": true, "SET": true, "CALL": true,
+	"DO": true, "HANDLER": true, "LOAD": true, "LOCK": true,
+	"SHARE": true, "INTO": true, "OUTFILE": true, "DUMPFILE": true,
+	"LOAD_FILE": true, "SLEEP": true, "BENCHMARK": true, "GET_LOCK": true,
+}
+
+// ValidateReadOnly checks the query is a single SELECT, possibly starting
+// with a WITH clause, reading only the demo tables, and returns it without
+// its trailing semicolon. The query is split as the database of the dialect
+// would split it.
+func ValidateReadOnly(d Dialect, query string) (string, error) {
+	query = strings.TrimSpace(query)
+	query = strings.TrimSpace(strings.TrimSuffix(query, ";"))
+
+	tokens, err := sqlTokens(d, query)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrStatementNotAllowed, err)
+	}
+	if len(tokens) == 0 {
+		return "", fmt.Errorf("%w: the query is empty", ErrStatementNotAllowed)
+	}
+	if !tokens[0].is(sqlWord, "SELECT") && !tokens[0].is(sqlWord, "WITH") {
+		return "", fmt.Errorf("%w: only SELECT queries can be explained", ErrStatementNotAllowed)
+	}
+	for _, t := range tokens {
+		switch {
+		case t.is(sqlPunct, ";"):
+			return "", fmt.Errorf("%w: only a single statement can be run", ErrStatementNotAllowed)
+		case t.kind == sqlWord && playgroundKeywords[t.text]:
+			return "", fmt.Errorf("%w: %s", ErrStatementNotAllowed, t.text)
+		}
+	}
+	if err := checkTables(tokens); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrStatementNotAllowed, err)
+	}
+
+	// MySQL refuses several statements unless the driver asks for them,
+	// modernc runs them all: SQLite has the last word on where they end.
+	if d == SQLite && !sqliteSingleStatement(query) {
+		return "", fmt.Errorf("%w: only a single statement can be run", ErrStatementNotAllowed)
+	}
+	return query, nil
+}
+
+type sqlTokenKind int
+
+const (
+	// sqlWord is a keyword or a name, upper cased.
+	sqlWord sqlTokenKind = iota
+	// sqlQuoted is a string or a quoted name, without its quotes.
+	sqlQuoted
+	// sqlPunct is any other character but spaces.
+	sqlPunct
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+}
+
+func (t sqlToken) is(kind sqlTokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+// sqlTokens splits a query into its tokens, leaving out spaces and comments.
+func sqlTokens(d Dialect, query string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case isSQLWordByte(c):
+			end := i + 1
+			for end < len(query) && isSQLWordByte(query[end]) {
+				end++
+			}
+			tokens = append(tokens, sqlToken{sqlWord, strings.ToUpper(query[i:end])})
+			i = end - 1
+		case c == '\'' || c == '"' || c == '`' || c == '[' && d == SQLite:
+			end, ok := sqlQuoteEnd(d, query, i)
+			if !ok {
+				return nil, errors.New("unterminated quote")
+			}
+			text := query[i+1 : end]
+			if c != '[' {
+				text = strings.ReplaceAll(text, string([]byte{c, c}), string(c))
+			}
+			tokens = append(tokens, sqlToken{sqlQuoted, text})
+			i = end
+		case c == '#' && d == MySQL || c == '-' && isSQLLineComment(d, query[i:]):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(query)
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			// MySQL runs the statements of /*! ... */ comments, all
+			// comments are rejected to stay on the safe side.
+			return nil, errors.New("comments are not allowed")
+		case c == ' ' || c >= '\t' && c <= '\r':
+		default:
+			tokens = append(tokens, sqlToken{sqlPunct, string(c)})
+		}
+	}
+	return tokens, nil
+}
+
+func isSQLWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' ||
+		c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// sqlQuoteEnd returns the index of the quote closing the one at start. Both
+// dialects double a quote to escape it, only MySQL escapes with backslashes
+// and then only in strings. SQLite also quotes names in brackets.
+func sqlQuoteEnd(d Dialect, query string, start int) (int, bool) {
+	open := query[start]
+	closing := open
+	if open == '[' {
+		closing = ']'
+	}
+	for end := start + 1; end < len(query); end++ {
+		switch {
+		case query[end] == '\\' && d == MySQL && open != '`':
+			end++
+		case query[end] == closing && open != '[' &&
+			end+1 < len(query) && query[end+1] == closing:
+			end++
+		case query[end] == closing:
+			return end, true
+		}
+	}
+	return 0, false
+}
+
+// isSQLLineComment tells whether the query starts with a comment running to
+// the end of the line. MySQL only reads -- as one when a space follows, 1--1
+// is a subtraction there.
+func isSQLLineComment(d Dialect, query string) bool {
+	if !strings.HasPrefix(query, "--") {
+		return false
+	}
+	if d == SQLite || len(query) == 2 {
+		return true
+	}
+	c := query[2]
+	return c == ' ' || c < ' ' || c == 0x7f
+}
+
+// sqliteSingleStatement tells whether the query holds no more than one
+// statement. sqlite3_complete tells a text ends a statement, at a semicolon
+// outside of strings, names and comments, so no prefix of the query ending
+// at a semicolon may be complete.
+func sqliteSingleStatement(query string) bool {
+	tls := libc.NewTLS()
+	defer tls.Close()
+
+	for i := 0; i < len(query); i++ {
+		if query[i] != ';' {
+			continue
+		}
+		s, err := libc.CString(query[:i+1])
+		if err != nil {
+			return false
+		}
+		complete := sqlite3.Xsqlite3_complete(tls, s)
+		libc.Xfree(tls, s)
+		if complete != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Explain runs a read-only query along with EXPLAIN and EXPLAIN ANALYZE in a
+// read-only transaction, stopping them once the limits are reached.
+func (s *Store) Explain(
+	ctx context.Context,
+	query string,
+	limits PlaygroundLimits,
+) (Explanation, error) {
+	query, err := ValidateReadOnly(s.Dialect, query)
+	if err != nil {
+		return Explanation{}, err
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, limits.Timeout)
+	defer cancel()
+
+	e, err := s.explain(runCtx, query, limits)
+	if err != nil && isTimeout(ctx, runCtx, err) {
+		return Explanation{}, fmt.Errorf("%w after %s", ErrQueryTimeout, limits.Timeout)
+	}
+	return e, err
+}
+
+// isTimeout tells whether the statement run with runCtx, derived from ctx,
+// failed with err for running out of time rather than ctx being done.
+func isTimeout(ctx, runCtx context.Context, err error) bool {
+	var myErr *mysql.MySQLError
+	return ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) ||
+		errors.As(err, &myErr) && myErr.Number == mysqlExecutionTimeExceeded
+}
+
+func (s *Store) explain(
+	ctx context.Context,
+	query string,
+	limits PlaygroundLimits,
+) (Explanation, error) {
+	// The session settings below are reset before the connection goes back
+	// to the pool.
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return Explanation{}, err
+	}
+	defer conn.Close()
+
+	switch s.Dialect {
+	case MySQL:
+		// The server stops the query too, the driver only gives up on it.
+		ms := limits.Timeout.Milliseconds()
+		if _, err := conn.ExecContext(ctx, "SET SESSION max_execution_time = ?", ms); err != nil {
+			return Explanation{}, fmt.Errorf("limit execution time: %v", err)
+		}
+		defer conn.ExecContext(context.Background(), "SET SESSION max_execution_time = DEFAULT")
+	case SQLite:
+		// SQLite ignores the read-only option of transactions.
+		if _, err := conn.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+			return Explanation{}, fmt.Errorf("read-only connection: %v", err)
+		}
+		defer conn.ExecContext(context.Background(), "PRAGMA query_only = OFF")
+	default:
+		return Explanation{}, fmt.Errorf("explain: %s: %w", s.Dialect, ErrUnsupported)
+	}
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return Explanation{}, err
+	}
+	defer tx.Rollback()
+
+	e := Explanation{Query: query}
+	explain := "EXPLAIN "
+	if s.Dialect == SQLite {
+		explain = "EXPLAIN QUERY PLAN "
+	}
+	if e.Plan, err = queryTable(ctx, tx, explain+query, 0); err != nil {
+		return Explanation{}, fmt.Errorf("explain: %v", err)
+	}
+	if e.Analysis, err = s.analyze(ctx, tx, query); err != nil {
+		return Explanation{}, fmt.Errorf("explain analyze: %v", err)
+	}
+
+	// Limiting the query spares reading the rows past the sample, the one
+	// extra row tells the sample is truncated.
+	sample := fmt.Sprintf("SELECT * FROM (%s) AS sample LIMIT %d", query, limits.MaxRows+1)
+	start := time.Now()
+	if e.Sample, err = queryTable(ctx, tx, sample, limits.MaxRows); err != nil {
+		return Explanation{}, fmt.Errorf("run: %v", err)
+	}
+	e.Elapsed = time.Since(start)
+
+	return e, nil
+}
+
+// sqlFromFunctions take FROM among their arguments, it names no table there.
+var sqlFromFunctions = map[string]bool{
+	"EXTRACT": true, "TRIM": true, "SUBSTRING": true, "SUBSTR": true,
+	"POSITION": true, "OVERLAY": true,
+}
+
+// sqlFromClauseEnds end the list of tables of a FROM clause.
+var sqlFromClauseEnds = map[string]bool{
+	"WHERE": true, "GROUP": true, "HAVING": true, "ORDER": true,
+	"LIMIT": true, "WINDOW": true, "UNION": true, "EXCEPT": true,
+	"INTERSECT": true, "SELECT": true, "WITH": true, "VALUES": true,
+	"SET": true,
+}
+
+// sqlTableModifiers may come between the word introducing a table and its
+// name, as in INSERT OR IGNORE INTO accounts.
+var sqlTableModifiers = map[string]bool{
+	"LATERAL": true, "INTO": true, "LOW_PRIORITY": true, "HIGH_PRIORITY": true,
+	"DELAYED": true, "IGNORE": true, "OR": true, "REPLACE": true,
+	"ROLLBACK": true, "ABORT": true, "FAIL": true,
+}
+
+// commonTable is a table a WITH clause names, known to the tokens between
+// from and to.
+type commonTable struct {
+	name     string
+	from, to int
+}
+
+// checkTables checks the tables the statement reads or writes are demo
+// tables of the store's own schema, or tables of its WITH clauses. The tables
+// are those following FROM, JOIN, UPDATE and the commas between them, TABLE,
+// INTO, and IN on SQLite which reads a table as in x IN employees.
+func checkTables(tokens []sqlToken) error {
+	depths := make([]int, len(tokens))
+	closing := map[int]int{}
+	var open []int
+	for i, t := range tokens {
+		depths[i] = len(open)
+		switch {
+		case t.is(sqlPunct, "("):
+			open = append(open, i)
+		case t.is(sqlPunct, ")"):
+			if len(open) == 0 {
+				return errors.New("unbalanced parentheses")
+			}
+			closing[open[len(open)-1]] = i
+			open = open[:len(open)-1]
+			depths[i] = len(open)
+		}
+	}
+	if len(open) > 0 {
+		return errors.New("unbalanced parentheses")
+	}
+	ctes := commonTables(tokens, depths, closing)
+
+	readable := func(name string, at int) bool {
+		if strings.EqualFold(name, "DUAL") {
+			return true
+		}
+		for _, table := range demoTables {
+			if strings.EqualFold(name, table) {
+				return true
+			}
+		}
+		for _, cte := range ctes {
+			if strings.EqualFold(name, cte.name) && cte.from <= at && at < cte.to {
+				return true
+			}
+		}
+		return false
+	}
+
+	// By depth of parentheses, whether a FROM clause lists its tables and
+	// whether they are the arguments of a function.
+	inFrom, inCall := []bool{false}, []bool{false}
+	expectTable := false
+	for i, t := range tokens {
+		top := len(inFrom) - 1
+		if expectTable {
+			expectTable = false
+			switch {
+			case t.kind == sqlWord && sqlTableModifiers[t.text]:
+				expectTable = true
+				continue
+			case t.is(sqlPunct, "("):
+				// A derived table or tables joined in parentheses.
+				inFrom, inCall = append(inFrom, true), append(inCall, false)
+				expectTable = true
+				continue
+			case t.kind == sqlWord && tokens[i-1].is(sqlPunct, "(") &&
+				(t.text == "SELECT" || t.text == "WITH" || t.text == "VALUES" || t.text == "TABLE"):
+				// The query of a derived table, read below.
+			case t.kind == sqlWord || t.kind == sqlQuoted:
+				if i+1 < len(tokens) && tokens[i+1].is(sqlPunct, ".") {
+					return fmt.Errorf("%s: the tables of other schemas are out of reach", t.text)
+				}
+				if !readable(t.text, i) {
+					return fmt.Errorf("%s is not a table of the demo", t.text)
+				}
+				continue
+			default:
+				return fmt.Errorf("a table is expected before %s", t.text)
+			}
+		}
+
+		switch {
+		case t.is(sqlPunct, "("):
+			call := i > 0 && tokens[i-1].kind == sqlWord && sqlFromFunctions[tokens[i-1].text]
+			inFrom, inCall = append(inFrom, false), append(inCall, call)
+		case t.is(sqlPunct, ")"):
+			inFrom, inCall = inFrom[:top], inCall[:top]
+		case t.is(sqlPunct, ","):
+			expectTable = inFrom[top]
+		case t.is(sqlWord, "FROM"):
+			if !inCall[top] {
+				inFrom[top] = true
+				expectTable = true
+			}
+		case t.is(sqlWord, "UPDATE") && (i == 0 || !tokens[i-1].is(sqlWord, "KEY")):
+			// Not the ON DUPLICATE KEY UPDATE of an insert, which sets
+			// columns.
+			inFrom[top] = true
+			expectTable = true
+		case t.is(sqlWord, "JOIN"), t.is(sqlWord, "STRAIGHT_JOIN"), t.is(sqlWord, "TABLE"),
+			t.is(sqlWord, "INTO"), t.is(sqlWord, "INSERT"):
+			expectTable = true
+		case t.is(sqlWord, "IN"):
+			expectTable = i+1 < len(tokens) && !tokens[i+1].is(sqlPunct, "(")
+		case t.kind == sqlWord && sqlFromClauseEnds[t.text]:
+			inFrom[top] = false
+		}
+	}
+	return nil
+}
+
+// commonTables returns the tables the WITH clauses of the query name. A
+// table is known from the end of its query on, and within it when recursive,
+// to the end of the query the clause belongs to.
+func commonTables(tokens []sqlToken, depths []int, closing map[int]int) []commonTable {
+	var ctes []commonTable
+	for i, t := range tokens {
+		if !t.is(sqlWord, "WITH") {
+			continue
+		}
+		to := i + 1
+		for to < len(tokens) && depths[to] >= depths[i] {
+			to++
+		}
+
+		j := i + 1
+		recursive := j < len(tokens) && tokens[j].is(sqlWord, "RECURSIVE")
+		if recursive {
+			j++
+		}
+		for j < len(tokens) && (tokens[j].kind == sqlWord || tokens[j].kind == sqlQuoted) {
+			name := tokens[j].text
+			j++
+			if j < len(tokens) && tokens[j].is(sqlPunct, "(") {
+				j = closing[j] + 1
+			}
+			if j >= len(tokens) || !tokens[j].is(sqlWord, "AS") {
+				break
+			}
+			j++
+			if j < len(tokens) && tokens[j].is(sqlWord, "NOT") {
+				j++
+			}
+			if j < len(tokens) && tokens[j].is(sqlWord, "MATERIALIZED") {
+				j++
+			}
+			if j >= len(tokens) || !tokens[j].is(sqlPunct, "(") {
+				break
+			}
+			end := closing[j]
+			from := end
+			if recursive {
+				from = i
+			}
+			ctes = append(ctes, commonTable{name: name, from: from, to: to})
+
+			j = end + 1
+			if j >= len(tokens) || !tokens[j].is(sqlPunct, ",") {
+				break
+			}
+			j++
+		}
+	}
+	return ctes
+}
@@ -0,0 +1,303 @@
+package sqlstorage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateReadOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   string
+		want    string
+		// allowed is false when the query must be rejected.
+		allowed bool
+	}{
+		{
+			name:    "select",
+			dialect: SQLite,
+			query:   "SELECT * FROM employees WHERE id = 1",
+			want:    "SELECT * FROM employees WHERE id = 1",
+			allowed: true,
+		},
+		{
+			name:    "trailing semicolon",
+			dialect: MySQL,
+			query:   "  SELECT 1;  ",
+			want:    "SELECT 1",
+			allowed: true,
+		},
+		{
+			name:    "with clause",
+			dialect: MySQL,
+			query:   "WITH e AS (SELECT * FROM employees) SELECT * FROM e",
+			want:    "WITH e AS (SELECT * FROM employees) SELECT * FROM e",
+			allowed: true,
+		},
+		{
+			name:    "keyword in a string",
+			dialect: SQLite,
+			query:   "SELECT * FROM employees WHERE name = 'drop; delete'",
+			want:    "SELECT * FROM employees WHERE name = 'drop; delete'",
+			allowed: true,
+		},
+		{
+			name:    "doubled quote",
+			dialect: SQLite,
+			query:   "SELECT 'it''s; DROP' FROM employees",
+			want:    "SELECT 'it''s; DROP' FROM employees",
+			allowed: true,
+		},
+		{
+			name:    "mysql backslash escape",
+			dialect: MySQL,
+			query:   `SELECT 'a\'; DROP' FROM employees`,
+			want:    `SELECT 'a\'; DROP' FROM employees`,
+			allowed: true,
+		},
+		{
+			name:    "sqlite backslash is no escape",
+			dialect: SQLite,
+			query:   `SELECT 'a\'; PRAGMA query_only = OFF; DROP TABLE employees; COMMIT; --'`,
+		},
+		{
+			name:    "sqlite backslash before a semicolon",
+			dialect: SQLite,
+			query:   `SELECT 'a\'; SELECT 1; --'`,
+		},
+		{
+			name:    "sqlite backslash in a quoted name",
+			dialect: SQLite,
+			query:   `SELECT "a\"; DELETE FROM employees; --"`,
+		},
+		{
+			name:    "sqlite bracket quoted name",
+			dialect: SQLite,
+			query:   "SELECT [a'] FROM employees; DELETE FROM employees",
+		},
+		{
+			name:    "mysql backtick has no backslash escape",
+			dialect: MySQL,
+			query:   "SELECT `a\\`; DELETE FROM employees; -- `",
+		},
+		{
+			name:    "sqlite hash is no comment",
+			dialect: SQLite,
+			query:   "SELECT 1 #\n; DELETE FROM employees",
+		},
+		{
+			name:    "mysql double dash without a space",
+			dialect: MySQL,
+			query:   "SELECT 1--1\n; DELETE FROM employees",
+		},
+		{
+			name:    "second statement",
+			dialect: SQLite,
+			query:   "SELECT 1; SELECT 2",
+		},
+		{
+			name:    "statement after a comment",
+			dialect: MySQL,
+			query:   "SELECT 1 -- ;\n; DROP TABLE employees",
+		},
+		{
+			name:    "block comment",
+			dialect: MySQL,
+			query:   "SELECT 1 /*! ; DROP TABLE employees */",
+		},
+		{
+			name:    "unterminated quote",
+			dialect: SQLite,
+			query:   "SELECT 'a",
+		},
+		{
+			name:    "update",
+			dialect: MySQL,
+			query:   "UPDATE employees SET name = 'x'",
+		},
+		{
+			name:    "pragma",
+			dialect: SQLite,
+			query:   "SELECT 1 FROM pragma_table_info('employees') WHERE PRAGMA",
+		},
+		{
+			name:    "joins and derived tables",
+			dialect: MySQL,
+			query: "SELECT * FROM employees e JOIN accounts a ON a.id = e.id, " +
+				"(SELECT * FROM sales) s WHERE e.id IN (SELECT id FROM employees)",
+			want: "SELECT * FROM employees e JOIN accounts a ON a.id = e.id, " +
+				"(SELECT * FROM sales) s WHERE e.id IN (SELECT id FROM employees)",
+			allowed: true,
+		},
+		{
+			name:    "from in a function",
+			dialect: MySQL,
+			query:   "SELECT EXTRACT(YEAR FROM hired), TRIM(' ' FROM name) FROM employees",
+			want:    "SELECT EXTRACT(YEAR FROM hired), TRIM(' ' FROM name) FROM employees",
+			allowed: true,
+		},
+		{
+			name:    "recursive with clause",
+			dialect: SQLite,
+			query:   "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 5) SELECT * FROM n",
+			want:    "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 5) SELECT * FROM n",
+			allowed: true,
+		},
+		{
+			name:    "sqlite schema",
+			dialect: SQLite,
+			query:   "SELECT * FROM sqlite_master",
+		},
+		{
+			name:    "quoted sqlite schema",
+			dialect: SQLite,
+			query:   `SELECT * FROM employees, "sqlite_master"`,
+		},
+		{
+			name:    "bracket quoted sqlite schema",
+			dialect: SQLite,
+			query:   "SELECT * FROM [sqlite_master]",
+		},
+		{
+			name:    "sqlite in table",
+			dialect: SQLite,
+			query:   "SELECT * FROM employees WHERE name IN sqlite_master",
+		},
+		{
+			name:    "information schema",
+			dialect: MySQL,
+			query:   "SELECT * FROM information_schema.tables",
+		},
+		{
+			name:    "quoted other schema",
+			dialect: MySQL,
+			query:   "SELECT * FROM employees JOIN `mysql`.`user` ON 1 = 1",
+		},
+		{
+			name:    "sandbox of another session",
+			dialect: MySQL,
+			query:   "SELECT * FROM desb_0123456789abcdef.employees",
+		},
+		{
+			name:    "scratch table",
+			dialect: MySQL,
+			query:   "SELECT * FROM employees e, de_scratch_jobs_0123abcd j",
+		},
+		{
+			name:    "tables in parentheses",
+			dialect: MySQL,
+			query:   "SELECT * FROM (employees, performance_schema.threads)",
+		},
+		{
+			name:    "table statement",
+			dialect: MySQL,
+			query:   "SELECT * FROM employees WHERE id IN (TABLE mysql.user)",
+		},
+		{
+			name:    "subquery",
+			dialect: SQLite,
+			query:   "SELECT (SELECT sql FROM sqlite_schema LIMIT 1) FROM employees",
+		},
+		{
+			name:    "with clause out of its query",
+			dialect: SQLite,
+			query:   "SELECT * FROM (WITH sqlite_master AS (SELECT 1) SELECT * FROM sqlite_master) a, sqlite_master",
+		},
+		{
+			name:    "with clause reading itself",
+			dialect: MySQL,
+			query:   "WITH threads AS (SELECT * FROM threads) SELECT * FROM threads",
+		},
+		{
+			name:    "for update",
+			dialect: MySQL,
+			query:   "SELECT * FROM accounts FOR UPDATE",
+		},
+		{
+			name:    "for share",
+			dialect: MySQL,
+			query:   "SELECT * FROM accounts FOR SHARE NOWAIT",
+		},
+		{
+			name:    "lock in share mode",
+			dialect: MySQL,
+			query:   "SELECT * FROM accounts LOCK IN SHARE MODE",
+		},
+		{
+			name:    "empty",
+			dialect: SQLite,
+			query:   " ; ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateReadOnly(tt.dialect, tt.query)
+			if !tt.allowed {
+				if !errors.Is(err, ErrStatementNotAllowed) {
+					t.Fatalf("ValidateReadOnly(%q) = %q, %v, want %v", tt.query, got, err, ErrStatementNotAllowed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateReadOnly(%q): %v", tt.query, err)
+			}
+			if got != tt.want {
+				t.Errorf("ValidateReadOnly(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteSingleStatement(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT 1", true},
+		{"SELECT ';'", true},
+		{`SELECT "a;b"`, true},
+		{"SELECT 1 -- ;", true},
+		{`SELECT 'a\'; SELECT 1`, false},
+		{"SELECT 1; SELECT 2", false},
+		{"SELECT [x;y] FROM employees", true},
+	}
+
+	for _, tt := range tests {
+		if got := sqliteSingleStatement(tt.query); got != tt.want {
+			t.Errorf("sqliteSingleStatement(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestCheckTables(t *testing.T) {
+	tests := []struct {
+		stmt string
+		ok   bool
+	}{
+		{"UPDATE accounts SET balance = balance - 10 WHERE id = 1", true},
+		{"INSERT INTO sales (qty, price) VALUES (1, 2)", true},
+		{"INSERT IGNORE INTO sales (qty, price) VALUES (1, 2) ON DUPLICATE KEY UPDATE qty = 1", true},
+		{"INSERT OR IGNORE INTO sales (qty, price) VALUES (1, 2)", true},
+		{"DELETE FROM sales WHERE id = 3", true},
+		{"UPDATE accounts a JOIN sales s ON s.id = a.id SET a.balance = s.qty", true},
+		{"UPDATE desb_0123456789abcdef.accounts SET balance = 0", false},
+		{"UPDATE LOW_PRIORITY `desb_0123456789abcdef`.`accounts` SET balance = 0", false},
+		{"UPDATE accounts, de.accounts SET balance = 0", false},
+		{"INSERT INTO de.sales (qty, price) VALUES (1, 2)", false},
+		{"INSERT de.sales (qty, price) VALUES (1, 2)", false},
+		{"DELETE FROM de.sales", false},
+		{"SELECT * FROM de.accounts", false},
+	}
+
+	for _, tt := range tests {
+		tokens, err := sqlTokens(MySQL, tt.stmt)
+		if err != nil {
+			t.Fatalf("sqlTokens(%q): %v", tt.stmt, err)
+		}
+		if err := checkTables(tokens); (err == nil) != tt.ok {
+			t.Errorf("checkTables(%q) = %v, want ok %v", tt.stmt, err, tt.ok)
+		}
+	}
+}
@@ -2,22 +2,112 @@ package sqlstorage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 )
 
 type Sale struct {
-	ID    uint64
-	Price uint64
-	Qty   uint64
+	ID    uint64 `json:"id"`
+	Price uint64 `json:"price"`
+	Qty   uint64 `json:"qty"`
+	// Version is bumped by every conditional update of the row, see
+	// UpdateQtyIfVersion.
+	Version uint64 `json:"version"`
 }
 
-func (s *Store) InsertSale(
+// ErrVersionConflict is returned by a conditional update of a row that was
+// changed since the version it expected.
+var ErrVersionConflict = errors.New("sale was changed since it was read")
+
+// scratchSalesPrefix starts the names of the scratch sales tables.
+const scratchSalesPrefix = "de_scratch_sales_"
+
+// SalesTable is a table of sales: the shared sales table or a scratch copy
+// owned by a single simulation, so that concurrent simulations do not see
+// each other's rows and locks.
+type SalesTable struct {
+	store *Store
+	Name  string
+}
+
+// Sales returns the shared sales table.
+func (s *Store) Sales() SalesTable {
+	return SalesTable{store: s, Name: "sales"}
+}
+
+// CreateScratchSales creates a uniquely named sales table holding the seed
+// rows, it is dropped with Drop once no longer needed.
+func (s *Store) CreateScratchSales(ctx context.Context) (SalesTable, error) {
+	name, err := scratchTableName(scratchSalesPrefix)
+	if err != nil {
+		return SalesTable{}, err
+	}
+
+	t := SalesTable{store: s, Name: name}
+	if err := t.create(ctx); err != nil {
+		return SalesTable{}, err
+	}
+	if err := t.seed(ctx); err != nil {
+		return SalesTable{}, errors.Join(err, t.Drop(ctx))
+	}
+
+	return t, nil
+}
+
+func (t SalesTable) create(ctx context.Context) error {
+	if _, err := t.store.DB.ExecContext(ctx, fmt.Sprintf(salesSchemas[t.store.Dialect], t.Name)); err != nil {
+		return fmt.Errorf("create %s: %v", t.Name, err)
+	}
+	return nil
+}
+
+// addVersion adds the version column to tables created before it existed.
+func (t SalesTable) addVersion(ctx context.Context) error {
+	if _, err := t.store.DB.ExecContext(ctx, "SELECT version FROM "+t.Name+" LIMIT 0"); err == nil {
+		return nil
+	}
+	query := "ALTER TABLE " + t.Name + " ADD COLUMN version INT NOT NULL DEFAULT 0"
+	if _, err := t.store.DB.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("add version to %s: %v", t.Name, err)
+	}
+	return nil
+}
+
+func (t SalesTable) Drop(ctx context.Context) error {
+	if _, err := t.store.DB.ExecContext(ctx, "DROP TABLE IF EXISTS "+t.Name); err != nil {
+		return fmt.Errorf("drop %s: %v", t.Name, err)
+	}
+	return nil
+}
+
+// Reset empties the table and inserts the seed rows again.
+func (t SalesTable) Reset(ctx context.Context) error {
+	if err := t.store.truncate(ctx, t.Name); err != nil {
+		return fmt.Errorf("truncate %s: %v", t.Name, err)
+	}
+	return t.seed(ctx)
+}
+
+func (t SalesTable) seed(ctx context.Context) error {
+	for i, sale := range [...]Sale{
+		{Price: 5, Qty: 10},
+		{Price: 4, Qty: 20},
+		{Price: 3, Qty: 30},
+	} {
+		if err := t.Insert(ctx, t.store.DB, sale.Price, sale.Qty); err != nil {
+			return fmt.Errorf("populate sale %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (t SalesTable) Insert(
 	ctx context.Context,
 	conn dbTx,
 	price, qty uint64,
 ) error {
-	const insertQuery = `
-	INSERT INTO sales(quantity, price)
+	insertQuery := `
+	INSERT INTO ` + t.Name + `(quantity, price)
 	VALUES (?, ?);
 	`
 	if _, err := conn.ExecContext(ctx, insertQuery, qty, price); err != nil {
@@ -27,12 +117,15 @@ func (s *Store) InsertSale(
 	return nil
 }
 
-func (s *Store) UpdateSaleQty(
+// UpdateQty blindly overwrites the quantity of a sale, whatever happened to
+// the row since it was read. The version is left alone, so the update goes
+// unnoticed by conditional updates.
+func (t SalesTable) UpdateQty(
 	ctx context.Context,
 	conn dbTx,
 	id, qty uint64,
 ) error {
-	const query = "UPDATE sales SET quantity = ? WHERE id = ?"
+	query := "UPDATE " + t.Name + " SET quantity = ? WHERE id = ?"
 	_, err := conn.ExecContext(ctx, query, qty, id)
 	if err != nil {
 		return err
@@ -40,12 +133,70 @@ func (s *Store) UpdateSaleQty(
 	return nil
 }
 
-func (s *Store) ListSales(
+// UpdateQtyIfVersion updates the quantity of a sale only if the row is still
+// at the version it was read at, bumping the version. It fails with
+// ErrVersionConflict otherwise, the caller then reads the row again and
+// retries: optimistic concurrency control, without holding any lock between
+// the read and the write.
+func (t SalesTable) UpdateQtyIfVersion(
+	ctx context.Context,
+	conn dbTx,
+	id, qty, version uint64,
+) error {
+	query := "UPDATE " + t.Name + " SET quantity = ?, version = version + 1 WHERE id = ? AND version = ?"
+	res, err := conn.ExecContext(ctx, query, qty, id, version)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("update sale %d at version %d: %w", id, version, ErrVersionConflict)
+	}
+	return nil
+}
+
+// Get reads a single sale. With forUpdate the row stays locked until the
+// transaction ends, SQLite having no row locks the transaction takes the
+// database write lock instead.
+func (t SalesTable) Get(
+	ctx context.Context,
+	conn dbTx,
+	id uint64,
+	forUpdate bool,
+) (Sale, error) {
+	query := "SELECT id, quantity, price, version FROM " + t.Name + " WHERE id = ?"
+	if forUpdate {
+		switch t.store.Dialect {
+		case SQLite:
+			// A write upgrades the transaction to the write lock before
+			// the read so the read cannot go stale.
+			lock := "UPDATE " + t.Name + " SET version = version WHERE id = ?"
+			if _, err := conn.ExecContext(ctx, lock, id); err != nil {
+				return Sale{}, err
+			}
+		default:
+			query += " FOR UPDATE"
+		}
+	}
+
+	var sale Sale
+	err := conn.QueryRowContext(ctx, query, id).Scan(&sale.ID, &sale.Qty, &sale.Price, &sale.Version)
+	if err != nil {
+		return Sale{}, fmt.Errorf("get sale %d: %v", id, err)
+	}
+	return sale, nil
+}
+
+func (t SalesTable) List(
 	ctx context.Context,
 	conn dbTx,
 	limit, offset uint64,
 ) ([]Sale, error) {
-	const query = "SELECT id, quantity, price FROM sales LIMIT ? OFFSET ?"
+	query := "SELECT id, quantity, price, version FROM " + t.Name + " LIMIT ? OFFSET ?"
 	if limit == 0 {
 		limit = 10
 	}
@@ -59,7 +210,7 @@ func (s *Store) ListSales(
 	var accs []Sale
 	for rows.Next() {
 		var acc Sale
-		if err := rows.Scan(&acc.ID, &acc.Qty, &acc.Price); err != nil {
+		if err := rows.Scan(&acc.ID, &acc.Qty, &acc.Price, &acc.Version); err != nil {
 			return nil, err
 		}
 		accs = append(accs, acc)
@@ -71,3 +222,48 @@ func (s *Store) ListSales(
 
 	return accs, nil
 }
+
+// ListBetween lists the sales with ids in [from, to], locking the rows and
+// the gaps between them when forUpdate is set.
+func (t SalesTable) ListBetween(
+	ctx context.Context,
+	conn dbTx,
+	from, to uint64,
+	forUpdate bool,
+) ([]Sale, error) {
+	query := "SELECT id, quantity, price, version FROM " + t.Name + " WHERE id BETWEEN ? AND ?"
+	if forUpdate {
+		switch t.store.Dialect {
+		case SQLite:
+			// As in Get, the write lock covers the whole database so the
+			// gaps too, even when no row is in the range.
+			lock := "UPDATE " + t.Name + " SET version = version WHERE id BETWEEN ? AND ?"
+			if _, err := conn.ExecContext(ctx, lock, from, to); err != nil {
+				return nil, err
+			}
+		default:
+			query += " FOR UPDATE"
+		}
+	}
+
+	rows, err := conn.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sales []Sale
+	for rows.Next() {
+		var sale Sale
+		if err := rows.Scan(&sale.ID, &sale.Qty, &sale.Price, &sale.Version); err != nil {
+			return nil, err
+		}
+		sales = append(sales, sale)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sales, nil
+}
@@ -0,0 +1,456 @@
+package sqlstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	// sandboxPrefix starts the names of the sandbox schemas and files.
+	sandboxPrefix = "desb_"
+	// sandboxMaxConns caps the connections of a sandbox, enough for the
+	// consoles and the simulation a visitor may run at once.
+	sandboxMaxConns = 6
+)
+
+// demoTables are the tables of the demo, a visitor can only reach these.
+var demoTables = []string{"accounts", "sales", "employees"}
+
+// sandboxTables are copied into a sandbox when it is created, the employees
+// are copied the first time a request needs them.
+var sandboxTables = []string{"accounts", "sales"}
+
+// ErrTooManySandboxes is returned when a new session asks for a sandbox while
+// the most there may be are live.
+var ErrTooManySandboxes = errors.New("too many sandboxes")
+
+type SandboxConfig struct {
+	// Dir holds the database files of the SQLite sandboxes.
+	Dir string
+	// Idle is how long a sandbox is kept once no request uses it.
+	Idle time.Duration
+	// Max bounds the sandboxes live at once, zero means no limit.
+	Max int
+}
+
+// Sandboxes hands every session its own copy of the demo database, so that
+// the changes made by one attendee of a workshop do not show up for another.
+// A sandbox is a schema on MySQL and a database file on SQLite, copied from
+// the base store the first time a session asks for it and dropped once it
+// has not been used for a while.
+type Sandboxes struct {
+	base *Store
+	cfg  SandboxConfig
+
+	mu    sync.Mutex
+	boxes map[string]*sandbox
+}
+
+type sandbox struct {
+	name string
+	// ready is closed once the sandbox is created, store or err are set.
+	ready chan struct{}
+	store *Store
+	err   error
+	// refs are the requests using the sandbox, it is not collected while
+	// any is in flight.
+	refs     int
+	lastUsed time.Time
+
+	// employeesMu is held while the employees are copied.
+	employeesMu sync.Mutex
+	employees   bool
+}
+
+func NewSandboxes(ctx context.Context, base *Store, cfg SandboxConfig) (*Sandboxes, error) {
+	if cfg.Idle <= 0 {
+		return nil, errors.New("sandbox idle time must be positive")
+	}
+	if base.Dialect == SQLite {
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("create sandbox dir: %v", err)
+		}
+	}
+
+	sb := &Sandboxes{
+		base:  base,
+		cfg:   cfg,
+		boxes: map[string]*sandbox{},
+	}
+
+	if err := sb.dropStale(ctx); err != nil {
+		return nil, fmt.Errorf("drop stale sandboxes: %v", err)
+	}
+
+	return sb, nil
+}
+
+// Acquire returns the store of the session's sandbox, creating it if needed,
+// with the employees copied when asked for. The sandbox is kept until release
+// is called and it then goes unused for the idle time.
+func (sb *Sandboxes) Acquire(
+	ctx context.Context,
+	session string,
+	employees bool,
+) (store *Store, release func(), err error) {
+	sb.mu.Lock()
+	box, ok := sb.boxes[session]
+	if !ok {
+		if sb.cfg.Max > 0 && len(sb.boxes) >= sb.cfg.Max {
+			sb.mu.Unlock()
+			return nil, nil, ErrTooManySandboxes
+		}
+		box = &sandbox{
+			name:  sandboxPrefix + session,
+			ready: make(chan struct{}),
+		}
+		sb.boxes[session] = box
+		go sb.create(box)
+	}
+	box.refs++
+	sb.mu.Unlock()
+
+	release = func() {
+		sb.mu.Lock()
+		defer sb.mu.Unlock()
+		box.refs--
+		box.lastUsed = time.Now()
+	}
+
+	select {
+	case <-box.ready:
+	case <-ctx.Done():
+		release()
+		return nil, nil, ctx.Err()
+	}
+
+	if box.err != nil {
+		release()
+		sb.mu.Lock()
+		if sb.boxes[session] == box {
+			delete(sb.boxes, session)
+		}
+		sb.mu.Unlock()
+		return nil, nil, box.err
+	}
+
+	if employees {
+		if err := sb.copyEmployees(ctx, box); err != nil {
+			release()
+			return nil, nil, err
+		}
+	}
+
+	return box.store, release, nil
+}
+
+// Lookup returns the store of the session's sandbox if it has one ready, it
+// is kept until release is called like with Acquire.
+func (sb *Sandboxes) Lookup(session string) (store *Store, release func(), ok bool) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	box, ok := sb.boxes[session]
+	if !ok {
+		return nil, nil, false
+	}
+	select {
+	case <-box.ready:
+	default:
+		return nil, nil, false
+	}
+	if box.err != nil {
+		return nil, nil, false
+	}
+
+	box.refs++
+	return box.store, func() {
+		sb.mu.Lock()
+		defer sb.mu.Unlock()
+		box.refs--
+		box.lastUsed = time.Now()
+	}, true
+}
+
+// create makes an empty sandbox and copies the small tables of the base
+// into it. It does not use the context of the request asking for it, another
+// may wait on the same box.
+func (sb *Sandboxes) create(box *sandbox) {
+	defer close(box.ready)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	start := time.Now()
+	var cfg Config
+	switch sb.base.Dialect {
+	case MySQL:
+		cfg, box.err = sb.createMySQL(ctx, box.name)
+	case SQLite:
+		cfg, box.err = sb.createSQLite(ctx, box.name)
+	default:
+		box.err = fmt.Errorf("sandbox %s: %w", sb.base.Dialect, ErrUnsupported)
+	}
+	if box.err != nil {
+		box.err = fmt.Errorf("create sandbox %s: %v", box.name, box.err)
+		return
+	}
+
+	box.store, box.err = Open(ctx, cfg)
+	if box.err != nil {
+		box.err = errors.Join(box.err, sb.drop(ctx, box.name))
+		return
+	}
+	box.store.DB.SetMaxOpenConns(sandboxMaxConns)
+	box.store.DB.SetMaxIdleConns(sandboxMaxConns)
+
+	if box.err = sb.copyTables(ctx, box.name, sandboxTables...); box.err != nil {
+		box.err = errors.Join(
+			fmt.Errorf("create sandbox %s: %v", box.name, box.err),
+			sb.close(ctx, box),
+		)
+		box.store = nil
+		return
+	}
+	log.Printf("created sandbox %s in %s", box.name, time.Since(start).Round(time.Millisecond))
+}
+
+// copyEmployees copies the employees into the sandbox unless they already
+// are, the requests needing them wait for the first to be done.
+func (sb *Sandboxes) copyEmployees(ctx context.Context, box *sandbox) error {
+	box.employeesMu.Lock()
+	defer box.employeesMu.Unlock()
+	if box.employees {
+		return nil
+	}
+
+	start := time.Now()
+	if err := sb.copyTables(ctx, box.name, "employees"); err != nil {
+		return fmt.Errorf("sandbox %s: %v", box.name, err)
+	}
+	box.employees = true
+	log.Printf("copied the employees into sandbox %s in %s", box.name, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func (sb *Sandboxes) createMySQL(ctx context.Context, name string) (Config, error) {
+	dsn, err := mysql.ParseDSN(sb.base.cfg.DSN)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if err := sb.drop(ctx, name); err != nil {
+		return Config{}, err
+	}
+	if _, err := sb.base.DB.ExecContext(ctx, "CREATE DATABASE "+name); err != nil {
+		return Config{}, err
+	}
+
+	dsn.DBName = name
+	return Config{Dialect: MySQL, DSN: dsn.FormatDSN()}, nil
+}
+
+func (sb *Sandboxes) createSQLite(ctx context.Context, name string) (Config, error) {
+	if err := sb.drop(ctx, name); err != nil {
+		return Config{}, err
+	}
+
+	dsn := "file:" + sb.sqlitePath(name)
+	if _, params, ok := strings.Cut(sb.base.cfg.DSN, "?"); ok {
+		dsn += "?" + params
+	}
+	return Config{Dialect: SQLite, DSN: dsn}, nil
+}
+
+// copyTables replaces the rows of the tables of the sandbox with those of
+// the base. On MySQL the tables are created again like those of the base,
+// keeping the indexes they have.
+func (sb *Sandboxes) copyTables(ctx context.Context, name string, tables ...string) error {
+	switch sb.base.Dialect {
+	case MySQL:
+		dsn, err := mysql.ParseDSN(sb.base.cfg.DSN)
+		if err != nil {
+			return err
+		}
+		base := dsn.DBName
+		for _, table := range tables {
+			for _, stmt := range []string{
+				fmt.Sprintf("DROP TABLE IF EXISTS %s.%s", name, table),
+				fmt.Sprintf("CREATE TABLE %s.%s LIKE %s.%s", name, table, base, table),
+				fmt.Sprintf("INSERT INTO %s.%s SELECT * FROM %s.%s", name, table, base, table),
+			} {
+				if _, err := sb.base.DB.ExecContext(ctx, stmt); err != nil {
+					return fmt.Errorf("copy %s: %v", table, err)
+				}
+			}
+		}
+		return nil
+	case SQLite:
+		// The sandbox is attached to a connection of the base, which is
+		// detached before the connection goes back to the pool.
+		conn, err := sb.base.DB.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		path := strings.ReplaceAll(sb.sqlitePath(name), "'", "''")
+		if _, err := conn.ExecContext(ctx, "ATTACH DATABASE '"+path+"' AS sandbox"); err != nil {
+			return err
+		}
+		for _, table := range tables {
+			for _, stmt := range []string{
+				"DELETE FROM sandbox." + table,
+				fmt.Sprintf("INSERT INTO sandbox.%s SELECT * FROM main.%s", table, table),
+			} {
+				if _, err := conn.ExecContext(ctx, stmt); err != nil {
+					_, detachErr := conn.ExecContext(context.Background(), "DETACH DATABASE sandbox")
+					return errors.Join(fmt.Errorf("copy %s: %v", table, err), detachErr)
+				}
+			}
+		}
+		_, err = conn.ExecContext(ctx, "DETACH DATABASE sandbox")
+		return err
+	}
+	return fmt.Errorf("copy tables: %s: %w", sb.base.Dialect, ErrUnsupported)
+}
+
+func (sb *Sandboxes) sqlitePath(name string) string {
+	return filepath.Join(sb.cfg.Dir, name+".db")
+}
+
+// drop removes the schema or files of a sandbox, its store must be closed.
+func (sb *Sandboxes) drop(ctx context.Context, name string) error {
+	switch sb.base.Dialect {
+	case MySQL:
+		_, err := sb.base.DB.ExecContext(ctx, "DROP DATABASE IF EXISTS "+name)
+		return err
+	case SQLite:
+		var errs []error
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			err := os.Remove(sb.sqlitePath(name) + suffix)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// dropStale drops the sandboxes left behind by a previous run of the
+// application.
+func (sb *Sandboxes) dropStale(ctx context.Context) error {
+	var names []string
+	switch sb.base.Dialect {
+	case MySQL:
+		rows, err := sb.base.DB.QueryContext(
+			ctx,
+			"SELECT schema_name FROM information_schema.schemata WHERE schema_name LIKE CONCAT(?, '%')",
+			sandboxPrefix,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			names = append(names, name)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	case SQLite:
+		paths, err := filepath.Glob(filepath.Join(sb.cfg.Dir, sandboxPrefix+"*.db"))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			names = append(names, strings.TrimSuffix(filepath.Base(path), ".db"))
+		}
+	}
+
+	for _, name := range names {
+		// The underscore of the prefix is a LIKE wildcard.
+		if !strings.HasPrefix(name, sandboxPrefix) {
+			continue
+		}
+		if err := sb.drop(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Collect drops the sandboxes no request has used for the idle time.
+func (sb *Sandboxes) Collect(ctx context.Context) {
+	sb.mu.Lock()
+	var idle []*sandbox
+	for session, box := range sb.boxes {
+		select {
+		case <-box.ready:
+		default:
+			continue
+		}
+		if box.refs == 0 && time.Since(box.lastUsed) > sb.cfg.Idle {
+			idle = append(idle, box)
+			delete(sb.boxes, session)
+		}
+	}
+	sb.mu.Unlock()
+
+	for _, box := range idle {
+		if err := sb.close(ctx, box); err != nil {
+			log.Printf("collect sandbox %s: %v", box.name, err)
+			continue
+		}
+		log.Printf("collected idle sandbox %s", box.name)
+	}
+}
+
+func (sb *Sandboxes) close(ctx context.Context, box *sandbox) error {
+	if box.store == nil {
+		return nil
+	}
+	return errors.Join(box.store.Close(ctx), sb.drop(ctx, box.name))
+}
+
+// Run collects idle sandboxes until the context is done.
+func (sb *Sandboxes) Run(ctx context.Context) {
+	ticker := time.NewTicker(min(sb.cfg.Idle, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sb.Collect(ctx)
+		}
+	}
+}
+
+// Close drops every sandbox.
+func (sb *Sandboxes) Close(ctx context.Context) error {
+	sb.mu.Lock()
+	boxes := sb.boxes
+	sb.boxes = map[string]*sandbox{}
+	sb.mu.Unlock()
+
+	var errs []error
+	for _, box := range boxes {
+		<-box.ready
+		errs = append(errs, sb.close(ctx, box))
+	}
+	return errors.Join(errs...)
+}
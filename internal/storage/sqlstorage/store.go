@@ -2,10 +2,13 @@ package sqlstorage
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -13,17 +16,55 @@ import (
 )
 
 type Store struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect Dialect
+	cfg     Config
 }
 
-func NewStore(ctx context.Context) (*Store, error) {
-	db, err := sql.Open("mysql", "detest:detest@tcp(localhost:3306)/detest")
+// NewStore connects to the demo database, creating its tables and seeding
+// them. The scratch tables left behind by a previous run are dropped.
+func NewStore(ctx context.Context, cfg Config) (*Store, error) {
+	s, err := Open(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.dropScratchTables(ctx); err != nil {
+		return nil, errors.Join(fmt.Errorf("drop scratch tables: %v", err), s.Close(ctx))
+	}
+
+	if err := s.Refresh(ctx); err != nil {
+		return nil, errors.Join(err, s.Close(ctx))
+	}
+
+	return s, nil
+}
+
+// Open connects to the database creating any missing table, the data already
+// in it is kept and so are the scratch tables, which may belong to a server
+// using the same database.
+func Open(ctx context.Context, cfg Config) (*Store, error) {
+	if cfg.Dialect == "" {
+		cfg.Dialect = MySQL
+	}
+	if cfg.DSN == "" {
+		cfg.DSN = defaultDSNs[cfg.Dialect]
+	}
+
+	driver, ok := drivers[cfg.Dialect]
+	if !ok {
+		return nil, fmt.Errorf("unsupported dialect %q", cfg.Dialect)
+	}
+
+	db, err := sql.Open(driver, cfg.DSN)
 	if err != nil {
 		return nil, err
 	}
 
 	s := &Store{
-		DB: db,
+		DB:      db,
+		Dialect: cfg.Dialect,
+		cfg:     cfg,
 	}
 
 	if err := s.init(ctx); err != nil {
@@ -47,61 +88,42 @@ func (s *Store) init(ctx context.Context) error {
 		return fmt.Errorf("ping: %w", err)
 	}
 
-	if _, err := s.DB.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS accounts (
-			id INT AUTO_INCREMENT,
-			balance INT NOT NULL,
-			PRIMARY KEY (id)
-		);
-`); err != nil {
-		return fmt.Errorf("create accounts table: %v", err)
-	}
-
-	if _, err := s.DB.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS sales (
-			id INT AUTO_INCREMENT,
-			quantity INT NOT NULL,
-			price INT NOT NULL,
-			PRIMARY KEY (id)
-		);
-`); err != nil {
-		return fmt.Errorf("create sales table: %v", err)
-	}
-
-	if _, err := s.DB.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS employees (
-			id INT AUTO_INCREMENT,
-			name VARCHAR(300) NOT NULL,
-			name2 VARCHAR(300) NOT NULL,
-			PRIMARY KEY (id),
-			INDEX(name)
-		);
-`); err != nil {
-		return fmt.Errorf("create employees table: %v", err)
-	}
-
-	return s.Refresh(ctx)
+	for _, stmt := range schemas[s.Dialect] {
+		if _, err := s.DB.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("create schema: %v", err)
+		}
+	}
+
+	if err := s.Sales().create(ctx); err != nil {
+		return fmt.Errorf("create schema: %v", err)
+	}
+
+	if err := s.Sales().addVersion(ctx); err != nil {
+		return fmt.Errorf("migrate schema: %v", err)
+	}
+
+	return nil
 }
 
 func (s *Store) Refresh(ctx context.Context) error {
-	if err := s.refreshAccounts(ctx); err != nil {
+	if err := s.RefreshAccounts(ctx); err != nil {
 		return err
 	}
 
-	if err := s.refreshSales(ctx); err != nil {
+	if err := s.RefreshSales(ctx); err != nil {
 		return err
 	}
 
-	if err := s.refreshEmployees(ctx); err != nil {
+	if err := s.RefreshEmployees(ctx); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (s *Store) refreshAccounts(ctx context.Context) error {
-	const truncateQuery = "TRUNCATE accounts"
-	if _, err := s.DB.ExecContext(ctx, truncateQuery); err != nil {
+// RefreshAccounts resets the accounts to their seed balances.
+func (s *Store) RefreshAccounts(ctx context.Context) error {
+	if err := s.truncate(ctx, "accounts"); err != nil {
 		return fmt.Errorf("truncate accounts: %v", err)
 	}
 
@@ -120,26 +142,82 @@ func (s *Store) refreshAccounts(ctx context.Context) error {
 	return nil
 }
 
-func (s *Store) refreshSales(ctx context.Context) error {
-	const truncateQuery = "TRUNCATE sales"
-	if _, err := s.DB.ExecContext(ctx, truncateQuery); err != nil {
-		return fmt.Errorf("truncate accounts: %v", err)
+// RefreshSales resets the shared sales table to its seed rows, leaving the
+// other demo tables untouched.
+func (s *Store) RefreshSales(ctx context.Context) error {
+	return s.Sales().Reset(ctx)
+}
+
+// scratchSuffixLen is the number of random bytes ending the name of a
+// scratch table, written in hex.
+const scratchSuffixLen = 4
+
+// scratchTableName draws a name for a scratch table starting with the prefix.
+func scratchTableName(prefix string) (string, error) {
+	suffix := make([]byte, scratchSuffixLen)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(suffix), nil
+}
+
+// isScratchTableName tells whether the name is one scratchTableName drew
+// with the prefix.
+func isScratchTableName(name, prefix string) bool {
+	suffix, ok := strings.CutPrefix(name, prefix)
+	if !ok || len(suffix) != 2*scratchSuffixLen || strings.ToLower(suffix) != suffix {
+		return false
+	}
+	_, err := hex.DecodeString(suffix)
+	return err == nil
+}
+
+// dropScratchTables drops the scratch sales tables and job queues left behind
+// by a previous run of the application that did not shut down cleanly.
+func (s *Store) dropScratchTables(ctx context.Context) error {
+	for _, prefix := range []string{scratchSalesPrefix, scratchJobsPrefix} {
+		if err := s.dropScratchTablesPrefixed(ctx, prefix); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+func (s *Store) dropScratchTablesPrefixed(ctx context.Context, prefix string) error {
+	// The underscore is a LIKE wildcard, the names are checked again below.
+	rows, err := s.DB.QueryContext(ctx, listTablesQueries[s.Dialect], prefix)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-	if err := s.InsertSale(ctx, s.DB, 5, 10); err != nil {
-		return fmt.Errorf("populate sale %d: %v", 1, err)
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if isScratchTableName(name, prefix) {
+			tables = append(tables, name)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	if err := s.InsertSale(ctx, s.DB, 4, 20); err != nil {
-		return fmt.Errorf("populate sale %d: %v", 2, err)
+	for _, name := range tables {
+		if _, err := s.DB.ExecContext(ctx, "DROP TABLE IF EXISTS "+name); err != nil {
+			return fmt.Errorf("drop %s: %v", name, err)
+		}
 	}
 
 	return nil
 }
 
-func (s *Store) refreshEmployees(ctx context.Context) error {
-	const truncateQuery = "TRUNCATE employees"
-	if _, err := s.DB.ExecContext(ctx, truncateQuery); err != nil {
+// RefreshEmployees reseeds the employees with their 998001 rows.
+func (s *Store) RefreshEmployees(ctx context.Context) error {
+	if err := s.truncate(ctx, "employees"); err != nil {
 		return fmt.Errorf("truncate employees: %v", err)
 	}
 
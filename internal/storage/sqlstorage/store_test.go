@@ -0,0 +1,29 @@
+package sqlstorage
+
+import "testing"
+
+func TestIsScratchTableName(t *testing.T) {
+	name, err := scratchTableName(scratchJobsPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name, true},
+		{"de_scratch_sales_0123abcd", false},
+		{"jobs_0123abcd", false},
+		{"de_scratch_jobs_archive", false},
+		{"de_scratch_jobs_0123abcd_old", false},
+		{"de_scratch_jobs_0123ABCD", false},
+		{"de_scratch_jobs_", false},
+	}
+
+	for _, tt := range tests {
+		if got := isScratchTableName(tt.name, scratchJobsPrefix); got != tt.want {
+			t.Errorf("isScratchTableName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}